@@ -0,0 +1,118 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// userAgent is sent with every HTTP request.
+	userAgent = "Wget/1.0 (+https://github.com/jesee-kuya/wget)"
+	// robotsAgent is the product token matched against robots.txt
+	// User-agent lines.
+	robotsAgent = "wget"
+)
+
+// dialer wraps net.Dialer to apply the -4/-6 address family restriction, the
+// --resolve host overrides and --unix-socket to every outgoing connection.
+type dialer struct {
+	net.Dialer
+	network    string            // "tcp", "tcp4" or "tcp6"
+	resolve    map[string]string // "host:port" -> replacement IP address
+	unixSocket string            // when set, every connection goes to this socket
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.unixSocket != "" {
+		// The URL still supplies the request path and Host header; only the
+		// transport is redirected.
+		return d.Dialer.DialContext(ctx, "unix", d.unixSocket)
+	}
+
+	if strings.HasPrefix(network, "tcp") {
+		network = d.network
+	}
+
+	if override, ok := d.resolve[strings.ToLower(addr)]; ok {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addr = net.JoinHostPort(override, port)
+	}
+
+	return d.Dialer.DialContext(ctx, network, addr)
+}
+
+// newDialer builds the dialer described by the connection options in opts.
+func newDialer(opts Options) (*dialer, error) {
+	if opts.Inet4Only && opts.Inet6Only {
+		return nil, fmt.Errorf("-4 and -6 cannot be used together")
+	}
+
+	d := &dialer{
+		Dialer:     net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		network:    "tcp",
+		resolve:    opts.Resolve,
+		unixSocket: opts.UnixSocket,
+	}
+	if opts.Inet4Only {
+		d.network = "tcp4"
+	} else if opts.Inet6Only {
+		d.network = "tcp6"
+	}
+
+	if opts.BindAddress != "" {
+		local, err := net.ResolveTCPAddr(d.network, net.JoinHostPort(opts.BindAddress, "0"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bind address %q: %w", opts.BindAddress, err)
+		}
+		d.LocalAddr = local
+	}
+
+	return d, nil
+}
+
+// newHTTPClient builds the HTTP client used for every request made with opts.
+func newHTTPClient(opts Options) (*http.Client, error) {
+	d, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	if opts.UnixSocket != "" {
+		// A proxy from HTTP_PROXY or HTTPS_PROXY would be dialed over the
+		// socket in place of the server listening on it
+		transport.Proxy = nil
+	}
+	if opts.WARCFile != "" {
+		// Archive bodies exactly as the server sent them
+		transport.DisableCompression = true
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// webClient returns the client for http:// and https:// URLs: the
+// --from-warc replay when there is one, otherwise httpClient.
+func webClient(opts Options) (*http.Client, error) {
+	if opts.replay != nil {
+		return opts.replay, nil
+	}
+	return httpClient(opts)
+}
+
+// httpClient returns the client shared through opts, or builds one for a
+// single download.
+func httpClient(opts Options) (*http.Client, error) {
+	if opts.client != nil {
+		return opts.client, nil
+	}
+	return newHTTPClient(opts)
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jesee-kuya/wget/logger"
+)
+
+// startServer serves handler on ln until the test ends.
+func startServer(t *testing.T, ln net.Listener, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+}
+
+func get(t *testing.T, opts Options, rawURL string) (string, error) {
+	t.Helper()
+	client, err := newHTTPClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestDialerAddressFamilyAndBindAddress(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startServer(t, ln, func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		io.WriteString(w, host)
+	})
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// "localhost" may resolve to ::1 first; -4 must reach the IPv4 listener
+	if got, err := get(t, Options{Inet4Only: true}, "http://localhost:"+port+"/"); err != nil || got != "127.0.0.1" {
+		t.Errorf("-4: got %q, %v", got, err)
+	}
+	// An IPv4 literal cannot be dialed over IPv6
+	if _, err := get(t, Options{Inet6Only: true}, "http://127.0.0.1:"+port+"/"); err == nil {
+		t.Error("-6 reached an IPv4-only listener")
+	}
+	if got, err := get(t, Options{BindAddress: "127.0.0.1"}, "http://127.0.0.1:"+port+"/"); err != nil || got != "127.0.0.1" {
+		t.Errorf("--bind-address: connected from %q, %v", got, err)
+	}
+	if _, err := newDialer(Options{BindAddress: "not an address"}); err == nil {
+		t.Error("newDialer accepted an invalid bind address")
+	}
+	if _, err := newDialer(Options{Inet4Only: true, Inet6Only: true}); err == nil {
+		t.Error("newDialer accepted -4 with -6")
+	}
+}
+
+func TestDialerResolve(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startServer(t, ln, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	})
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	opts := Options{Resolve: map[string]string{"lb.example.test:" + port: "127.0.0.1"}}
+	if got, err := get(t, opts, "http://LB.example.test:"+port+"/"); err != nil || got != "LB.example.test:"+port {
+		t.Errorf("--resolve: got Host %q, %v", got, err)
+	}
+}
+
+func TestUnixSocketIgnoresProxy(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	startServer(t, ln, func(w http.ResponseWriter, r *http.Request) {
+		// A proxied request carries the absolute URL
+		io.WriteString(w, r.RequestURI)
+	})
+	t.Setenv("HTTP_PROXY", "http://proxy.invalid:3128")
+	t.Setenv("HTTPS_PROXY", "http://proxy.invalid:3128")
+
+	if got, err := get(t, Options{UnixSocket: sock}, "http://registry.internal/v2/"); err != nil || got != "/v2/" {
+		t.Errorf("--unix-socket with a proxy set: got %q, %v", got, err)
+	}
+}
+
+func TestDownloadFileOverUnixSocket(t *testing.T) {
+	// The URL names a TCP listener that must not be used
+	decoy, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	startServer(t, decoy, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request for %s reached the TCP listener", r.URL)
+	})
+
+	sock := filepath.Join(t.TempDir(), "registry.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	requests := make(chan *http.Request, 1)
+	startServer(t, ln, func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		io.WriteString(w, "manifest")
+	})
+
+	rawURL := "http://" + decoy.Addr().String() + "/v2/app/manifests/latest?arch=amd64"
+	opts := Options{OutputDir: t.TempDir(), OutputName: "manifest.json", UnixSocket: sock}
+	if err := DownloadFile(rawURL, opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if r.Host != decoy.Addr().String() || r.RequestURI != "/v2/app/manifests/latest?arch=amd64" {
+		t.Errorf("socket got Host %q and path %q", r.Host, r.RequestURI)
+	}
+	if body, _ := os.ReadFile(filepath.Join(opts.OutputDir, "manifest.json")); string(body) != "manifest" {
+		t.Errorf("saved %q", body)
+	}
+}
@@ -0,0 +1,422 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/robots"
+)
+
+// crawler runs the HTTP part of MirrorSite: a pool of --mirror-workers
+// workers sharing a frontier of URLs still to fetch and the set of URLs
+// already queued, so every URL is fetched once.
+type crawler struct {
+	base *url.URL
+	opts Options
+	log  *logger.Logger
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	frontier   []*crawlTask
+	queued     map[string]*crawlTask
+	active     int  // URLs taken from the frontier and not finished yet
+	stopped    bool // set once the quota is used up
+	hosts      map[string]*hostState
+	duplicates map[string]string // with --canonical: page URL -> canonical URL it defers to
+	adjusted   map[string]string // with -E: URL -> output path with the extension added
+
+	writeMu sync.Mutex
+	claims  map[string]string // output path -> URL whose body it holds
+
+	convertMu sync.Mutex
+	spool     *os.File     // bodies of pendingDocs
+	pending   []pendingDoc // with -E and --convert-links, documents converted after the crawl
+
+	logMu sync.Mutex
+}
+
+// hostState is what the crawl tracks about each scheme and host.
+type hostState struct {
+	slots      chan struct{} // in-flight requests, nil without a host limit
+	robotsOnce sync.Once
+	robots     *robots.Rules
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request under Crawl-delay
+}
+
+// pendingDoc is an HTML page or stylesheet whose links are converted, and
+// which is written, once the crawl is over.
+type pendingDoc struct {
+	url          *url.URL
+	outputPath   string
+	css          bool
+	offset, size int64 // where the body is in the spool
+}
+
+// crawlTask is a queued URL and the number of links followed to reach it
+// from the start URL.
+type crawlTask struct {
+	url     string
+	depth   int
+	pending bool // in the frontier
+}
+
+func newCrawler(base *url.URL, opts Options, log *logger.Logger) *crawler {
+	c := &crawler{
+		base:       base,
+		opts:       opts,
+		log:        log,
+		queued:     make(map[string]*crawlTask),
+		hosts:      make(map[string]*hostState),
+		claims:     make(map[string]string),
+		duplicates: make(map[string]string),
+		adjusted:   make(map[string]string),
+	}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// run crawls from startURL until the frontier is exhausted.
+func (c *crawler) run(startURL string) {
+	c.enqueue([]string{startURL}, 0)
+	if c.opts.Sitemap {
+		c.seedFromSitemaps()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(c.opts.MirrorWorkers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				rawURL, depth, ok := c.next()
+				if !ok {
+					return
+				}
+				c.visit(rawURL, depth)
+				c.finish()
+			}
+		}()
+	}
+	wg.Wait()
+	c.convertDeferred()
+}
+
+// enqueue appends links found at the given depth to the frontier, unless
+// they are beyond -l or already queued. A URL reached again by a shorter
+// path takes the smaller depth, and is fetched again if it was already
+// done, so that how deep the crawl goes does not depend on which worker
+// got there first.
+func (c *crawler) enqueue(links []string, depth int) {
+	if c.opts.MaxDepth > 0 && depth > c.opts.MaxDepth {
+		return
+	}
+	c.push(links, depth)
+}
+
+// push is enqueue without the -l limit, for page requisites, which -p
+// fetches however deep the page that needs them is.
+func (c *crawler) push(links []string, depth int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, link := range links {
+		t, ok := c.queued[link]
+		switch {
+		case !ok:
+			t = &crawlTask{url: link, depth: depth, pending: true}
+			c.queued[link] = t
+			c.frontier = append(c.frontier, t)
+		case depth < t.depth:
+			t.depth = depth
+			if !t.pending {
+				t.pending = true
+				c.frontier = append(c.frontier, t)
+			}
+		}
+	}
+	c.cond.Broadcast()
+}
+
+// next waits for a URL to fetch and returns it with its depth. It reports
+// false once the frontier is empty and no busy worker can add to it, or
+// after stop.
+func (c *crawler) next() (string, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.frontier) == 0 && c.active > 0 && !c.stopped {
+		c.cond.Wait()
+	}
+	if c.stopped || len(c.frontier) == 0 {
+		return "", 0, false
+	}
+
+	t := c.frontier[0]
+	c.frontier = c.frontier[1:]
+	t.pending = false
+	c.active++
+	return t.url, t.depth, true
+}
+
+// isQueued reports whether rawURL was ever queued for the crawl.
+func (c *crawler) isQueued(rawURL string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.queued[rawURL]
+	return ok
+}
+
+// deferTo records that the page at rawURL is a duplicate of its canonical
+// URL, reporting false if the canonical page already deferred to rawURL, in
+// which case rawURL is kept so that one of the two is saved.
+func (c *crawler) deferTo(rawURL, canonical string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.duplicates[canonical] == rawURL {
+		return false
+	}
+	c.duplicates[rawURL] = canonical
+	return true
+}
+
+// canonicalOf returns the canonical URL the page at rawURL deferred to, or
+// rawURL.
+func (c *crawler) canonicalOf(rawURL string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if canonical, ok := c.duplicates[rawURL]; ok {
+		return canonical
+	}
+	return rawURL
+}
+
+// finish marks a URL returned by next as done.
+func (c *crawler) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+	c.cond.Broadcast()
+}
+
+// stop ends the crawl, reporting whether this call was the one to do so.
+func (c *crawler) stop() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first := !c.stopped
+	c.stopped = true
+	c.cond.Broadcast()
+	return first
+}
+
+// host returns the state kept for u's scheme and host.
+func (c *crawler) host(u *url.URL) *hostState {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.hosts[key]
+	if !ok {
+		h = &hostState{}
+		if c.opts.MirrorHostLimit > 0 {
+			h.slots = make(chan struct{}, c.opts.MirrorHostLimit)
+		}
+		c.hosts[key] = h
+	}
+	return h
+}
+
+// acquireHost blocks until fewer than --mirror-host-limit requests to u's
+// host are in flight and its robots.txt Crawl-delay has passed since the
+// previous request. The returned function releases the slot.
+func (c *crawler) acquireHost(u *url.URL) func() {
+	h := c.host(u)
+	if h.slots != nil {
+		h.slots <- struct{}{}
+	}
+
+	if rules := c.robotsFor(u); rules != nil && rules.CrawlDelay > 0 {
+		h.mu.Lock()
+		now := time.Now()
+		start := h.next
+		if start.Before(now) {
+			start = now
+		}
+		h.next = start.Add(rules.CrawlDelay)
+		h.mu.Unlock()
+		time.Sleep(time.Until(start))
+	}
+
+	return func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}
+}
+
+// robotsFor returns the robots.txt rules of u's host, fetching them on first
+// use, or nil with -e robots=off.
+func (c *crawler) robotsFor(u *url.URL) *robots.Rules {
+	if c.opts.IgnoreRobots {
+		return nil
+	}
+	h := c.host(u)
+	h.robotsOnce.Do(func() {
+		h.robots = fetchRobots(u, c.opts)
+	})
+	return h.robots
+}
+
+// fetchRobots retrieves /robots.txt for u's host. As RFC 9309 asks, a
+// missing file (4xx) allows everything, while a server error or an
+// unreachable server disallows everything. When replaying --from-warc, a
+// robots.txt that was not recorded allows everything.
+func fetchRobots(u *url.URL, opts Options) *robots.Rules {
+	robotsURL := &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	// RFC 9309 lets crawlers stop reading after 500 KiB
+	resp, data, err := fetchBytes(robotsURL.String(), 500<<10, opts)
+	if err != nil {
+		if opts.FromWARC != "" {
+			return robots.AllowAll()
+		}
+		return robots.DisallowAll()
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		rules, err := robots.Parse(bytes.NewReader(data), robotsAgent)
+		if err != nil {
+			return robots.DisallowAll()
+		}
+		return rules
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return robots.AllowAll()
+	default:
+		return robots.DisallowAll()
+	}
+}
+
+// fetchBytes GETs a small crawl resource such as robots.txt or a sitemap,
+// reading at most limit bytes of the body, and archives the exchange with
+// --warc-file.
+func fetchBytes(rawURL string, limit int64, opts Options) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	remoteIP := func() string { return "" }
+	if opts.warc != nil {
+		req, remoteIP = traceRemoteIP(req)
+	}
+
+	client, err := webClient(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	resp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.warc != nil {
+		if err := opts.warc.WriteExchange(resp.Request, resp, remoteIP(), bytes.NewReader(data)); err != nil {
+			return nil, nil, err
+		}
+	}
+	return resp, data, nil
+}
+
+// write stores data as outputPath on behalf of rawURL. When several URLs map
+// to the same file, the lexically smallest URL wins whatever order they
+// were fetched in, so the mirror on disk does not depend on scheduling. It
+// returns the URL whose body the file holds afterwards.
+func (c *crawler) write(outputPath, rawURL string, data []byte) (string, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if prev, ok := c.claims[outputPath]; ok && prev < rawURL {
+		return prev, nil
+	}
+	c.claims[outputPath] = rawURL
+	return rawURL, writeSinkFile(c.opts.sink, outputPath, data)
+}
+
+// deferConversion keeps body, the document at u to be saved as outputPath,
+// until convertDeferred rewrites its links.
+func (c *crawler) deferConversion(u *url.URL, outputPath string, css bool, body []byte) error {
+	c.convertMu.Lock()
+	defer c.convertMu.Unlock()
+	if c.spool == nil {
+		f, err := os.CreateTemp("", "wget-convert-*")
+		if err != nil {
+			return err
+		}
+		c.spool = f
+	}
+	offset, err := c.spool.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := c.spool.Write(body); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, pendingDoc{url: u, outputPath: outputPath, css: css, offset: offset, size: int64(len(body))})
+	return nil
+}
+
+// convertDeferred converts the links of the documents kept by
+// deferConversion, now that the name of every file is known, and writes
+// them.
+func (c *crawler) convertDeferred() {
+	if c.spool == nil {
+		return
+	}
+	defer os.Remove(c.spool.Name())
+	defer c.spool.Close()
+
+	sort.Slice(c.pending, func(i, j int) bool { return c.pending[i].url.String() < c.pending[j].url.String() })
+	for _, doc := range c.pending {
+		body := make([]byte, doc.size)
+		if _, err := c.spool.ReadAt(body, doc.offset); err != nil {
+			c.log.Error(fmt.Errorf("failed to read %s back for link conversion: %w", doc.url, err))
+			continue
+		}
+		if rewritten, err := c.convertLinks(doc.url, doc.outputPath, doc.css, body); err != nil {
+			c.log.Error(fmt.Errorf("rewrite links failed for %s: %w", doc.url, err))
+		} else {
+			body = rewritten
+		}
+		if _, err := c.write(doc.outputPath, doc.url.String(), body); err != nil {
+			c.log.Error(fmt.Errorf("write failed %s: %w", doc.outputPath, err))
+		}
+	}
+}
+
+// taskLogger returns the logger for one URL. With several workers each URL
+// logs into a buffer that is printed in one piece when flush is called,
+// keeping concurrent progress lines apart.
+func (c *crawler) taskLogger() (log *logger.Logger, flush func()) {
+	if c.opts.MirrorWorkers <= 1 {
+		return c.log, func() {}
+	}
+
+	var buf bytes.Buffer
+	return logger.NewLogger(&buf), func() {
+		c.logMu.Lock()
+		defer c.logMu.Unlock()
+		c.log.Output.Write(buf.Bytes())
+	}
+}
@@ -1,127 +1,279 @@
 package downloader
 
 import (
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/metalink"
 	"github.com/jesee-kuya/wget/util"
 )
 
 // DownloadFile downloads a file from the specified URL and saves it to the output directory.
-func DownloadFile(url string, opts Options, log *logger.Logger) error {
+// The URL scheme selects the Fetcher (see RegisterFetcher); with opts.Continue a partial
+// local file is resumed.
+func DownloadFile(rawURL string, opts Options, log *logger.Logger) error {
+	if opts.quota.Exceeded() {
+		log.Skipped(rawURL, ErrQuotaExceeded.Error())
+		return ErrQuotaExceeded
+	}
+
 	startTime := time.Now()
-	log.Start(url, startTime)
+	log.Start(rawURL, startTime)
 
-	resp, err := http.Get(url)
+	u, err := url.Parse(rawURL)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		err := fmt.Errorf("bad status from: %s, status code: %d", url, resp.StatusCode)
+	closeSink, err := openSink(&opts)
+	if err != nil {
 		log.Error(err)
 		return err
 	}
+	defer func() {
+		if err := closeSink(); err != nil {
+			log.Error(err)
+		}
+	}()
 
-	log.Status(resp.StatusCode)
-	log.ContentInfo(resp.ContentLength)
+	closeWARC, err := openWARC(&opts)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer func() {
+		if err := closeWARC(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	closeReplay, err := openReplay(&opts)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer closeReplay()
 
 	// Determine output path
 	filename := opts.OutputName
 	if filename == "" {
-		filename = util.ExtractFilenameFromURL(url)
+		filename = opts.RestrictFileNames.Name(util.ExtractFilenameFromURL(rawURL))
 	}
-	resolvedDir, err := util.ProcessDirectoryPath(opts.OutputDir, true, 0o755)
-	if err != nil {
-		log.Error(fmt.Errorf("failed to process output directory: %w", err))
-		return err
-	}
-	outputPath := filepath.Join(resolvedDir, filename)
+	outputPath := filepath.Join(opts.OutputDir, filename)
+
+	// Resuming, free-space checks and preallocation only apply to local files
+	local, isLocal := opts.sink.(*dirSink)
+	var resolvedDir string
+	var offset int64
+	if isLocal {
+		resolvedDir, err = util.ProcessDirectoryPath(local.path(opts.OutputDir), true, 0o755)
+		if err != nil {
+			log.Error(fmt.Errorf("failed to process output directory: %w", err))
+			return err
+		}
+		outputPath = filepath.Join(resolvedDir, filename)
 
-	log.SavingTo(outputPath)
+		if opts.Continue {
+			if info, err := os.Stat(outputPath); err == nil && info.Mode().IsRegular() {
+				offset = info.Size()
+			}
+		}
+	}
 
-	outFile, err := os.Create(outputPath)
+	res, err := openResource(u, offset, opts)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
-	defer outFile.Close()
+	defer res.Body.Close()
+
+	total := res.Size
+	if total >= 0 {
+		total += res.Offset
+	}
+
+	log.Reply(res.Status)
+
+	if !opts.noMetalink && isMetalink(res.ContentType) {
+		m, err := metalink.Parse(io.LimitReader(res.Body, maxMetalinkSize))
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		return downloadMetalink(m, opts, log)
+	}
+
+	log.ContentInfo(total)
+
+	if opts.MaxFileSize > 0 && total > opts.MaxFileSize {
+		log.Skipped(rawURL, fmt.Sprintf("size %s exceeds --max-filesize %s",
+			util.ContentSize(total), util.ContentSize(opts.MaxFileSize)))
+		return ErrFileTooLarge
+	}
+
+	if opts.quota.Exceeded() {
+		log.Skipped(rawURL, ErrQuotaExceeded.Error())
+		return ErrQuotaExceeded
+	}
+
+	var outFile SinkFile
+	if isLocal {
+		if err := util.CheckDiskSpace(resolvedDir, res.Size); err != nil {
+			log.Error(err)
+			return err
+		}
+
+		log.SavingTo(outputPath)
+
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if res.Offset > 0 {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(outputPath, flags, 0o644)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		outFile = &localFile{File: f}
+
+		if err := util.Preallocate(f, total); err != nil {
+			if res.Offset == 0 {
+				outFile.Discard()
+			} else {
+				f.Close()
+			}
+			log.Error(err)
+			return err
+		}
+	} else {
+		log.SavingTo(opts.sink.Location(outputPath))
+
+		outFile, err = opts.sink.Create(outputPath)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
 
-	const bufSize = 32 * 1024
-	buf := make([]byte, bufSize)
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	var written int64
+	var written atomic.Int64
 	start := time.Now()
 
 	done := make(chan error, 1)
-
 	go func() {
-		var lastReadTime time.Time
-
-		for {
-			n, readErr := resp.Body.Read(buf)
-			if n > 0 {
-				if opts.RateLimit > 0 {
-					now := time.Now()
-					if !lastReadTime.IsZero() {
-						elapsed := now.Sub(lastReadTime)
-						expected := time.Duration(float64(n) / opts.RateLimit * 1e9)
-						if expected > elapsed {
-							time.Sleep(expected - elapsed)
-						}
-					}
-					lastReadTime = time.Now()
-				}
+		done <- copyBody(outFile, res.Body, res.Offset, &written, opts)
+	}()
 
-				nw, writeErr := outFile.Write(buf[:n])
-				if writeErr != nil {
-					done <- writeErr
-					return
+	for {
+		select {
+		case <-ticker.C:
+			elapsed := time.Since(start).Seconds()
+			if elapsed > 0 {
+				n := written.Load()
+				speed := float64(n) / elapsed
+				eta := time.Duration(float64(total-res.Offset-n)/speed) * time.Second
+				log.Progress(res.Offset+n, total, speed, eta)
+			}
+		case err := <-done:
+			if errors.Is(err, syscall.ENOSPC) {
+				target := resolvedDir
+				if !isLocal {
+					target = opts.sink.Location(outputPath)
 				}
-				if nw != n {
-					done <- io.ErrShortWrite
-					return
+				err = fmt.Errorf("%w on %s: wrote %d of %d bytes", util.ErrInsufficientSpace, target, res.Offset+written.Load(), total)
+			}
+			if err == ErrFileTooLarge {
+				if res.Offset == 0 {
+					outFile.Discard()
+				} else {
+					outFile.Close()
 				}
-				written += int64(nw)
+				log.Skipped(rawURL, fmt.Sprintf("streamed size exceeds --max-filesize %s", util.ContentSize(opts.MaxFileSize)))
+				return err
 			}
-
-			if readErr != nil {
-				if readErr == io.EOF {
-					done <- nil
+			if err != nil {
+				// Local partial files are kept so that -c can resume them
+				if isLocal {
+					outFile.Close()
 				} else {
-					done <- readErr
+					outFile.Discard()
 				}
-				return
+				log.Error(err)
+				return err
 			}
+			if err := outFile.Close(); err != nil {
+				log.Error(err)
+				return err
+			}
+			// Closing the body also writes the exchange to --warc-file
+			if err := res.Body.Close(); err != nil {
+				log.Error(err)
+				return err
+			}
+			n := written.Load()
+			log.Progress(res.Offset+n, total, float64(n)/time.Since(start).Seconds(), 0)
+			log.Done(time.Now(), rawURL)
+			return nil
 		}
-	}()
+	}
+}
+
+// copyBody streams body into w, pausing as needed to keep to --limit-rate.
+// offset is the size the file already has: once the copy would take it past
+// --max-filesize, copyBody stops with ErrFileTooLarge. Every byte written is
+// counted in written and in the quota.
+func copyBody(w io.Writer, body io.Reader, offset int64, written *atomic.Int64, opts Options) error {
+	buf := make([]byte, 32*1024)
+	var lastReadTime time.Time
+	var copied int64
 
 	for {
-		select {
-		case <-ticker.C:
-			elapsed := time.Since(start).Seconds()
-			if elapsed > 0 {
-				speed := float64(written) / elapsed
-				eta := time.Duration(float64(resp.ContentLength-written)/speed) * time.Second
-				log.Progress(written, resp.ContentLength, speed, eta)
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if opts.MaxFileSize > 0 && offset+copied+int64(n) > opts.MaxFileSize {
+				return ErrFileTooLarge
 			}
-		case err := <-done:
+
+			if opts.RateLimit > 0 {
+				now := time.Now()
+				if !lastReadTime.IsZero() {
+					elapsed := now.Sub(lastReadTime)
+					expected := time.Duration(float64(n) / opts.RateLimit * 1e9)
+					if expected > elapsed {
+						time.Sleep(expected - elapsed)
+					}
+				}
+				lastReadTime = time.Now()
+			}
+
+			nw, err := w.Write(buf[:n])
+			copied += int64(nw)
+			written.Add(int64(nw))
+			opts.quota.Add(int64(nw))
 			if err != nil {
-				log.Error(err)
 				return err
 			}
-			log.Progress(written, resp.ContentLength, float64(written)/time.Since(start).Seconds(), 0)
-			log.Done(time.Now(), url)
+			if nw != n {
+				return io.ErrShortWrite
+			}
+		}
+
+		if readErr == io.EOF {
 			return nil
 		}
+		if readErr != nil {
+			return readErr
+		}
 	}
 }
@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/util"
+)
+
+func TestDownloadInputStopsAtQuota(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var list strings.Builder
+	for i := range 12 {
+		fmt.Fprintf(&list, "%s/file%d.txt\n", srv.URL, i)
+	}
+	input := filepath.Join(dir, "urls.txt")
+	if err := os.WriteFile(input, []byte(list.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+	DownloadInput(Options{InputFile: input, OutputDir: out, Quota: 100}, logger.NewLogger(io.Discard))
+
+	// Only the downloads already in flight when the first one finished may
+	// have been started
+	if n := requests.Load(); n > maxInputDownloads {
+		t.Errorf("server got %d requests, want at most %d", n, maxInputDownloads)
+	}
+	saved, _ := os.ReadDir(out)
+	if len(saved) == 0 || len(saved) > maxInputDownloads {
+		t.Errorf("saved %d files, want between 1 and %d", len(saved), maxInputDownloads)
+	}
+}
+
+func TestDownloadFileMaxFileSize(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sized.bin":
+			w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+			io.WriteString(w, body)
+		case "/chunked.bin":
+			// Flushing before the end leaves the length unknown, so the
+			// body is sent chunked
+			for i := 0; i < len(body); i += 1024 {
+				io.WriteString(w, body[i:i+1024])
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer srv.Close()
+
+	for _, name := range []string{"sized.bin", "chunked.bin"} {
+		t.Run(name, func(t *testing.T) {
+			opts := Options{OutputDir: t.TempDir(), MaxFileSize: 1024}
+			err := DownloadFile(srv.URL+"/"+name, opts, logger.NewLogger(io.Discard))
+			if !errors.Is(err, ErrFileTooLarge) {
+				t.Fatalf("DownloadFile = %v, want ErrFileTooLarge", err)
+			}
+			if _, err := os.Stat(filepath.Join(opts.OutputDir, name)); !os.IsNotExist(err) {
+				t.Errorf("oversized %s was left on disk", name)
+			}
+		})
+	}
+}
+
+func TestDownloadFileInsufficientSpace(t *testing.T) {
+	dir := t.TempDir()
+	if avail, err := util.AvailableSpace(dir); err != nil || avail < 0 {
+		t.Skip("free space is not known on this platform")
+	}
+
+	// No disk holds an exabyte, so the announced size alone is refused
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.FormatInt(1<<60, 10))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	var out strings.Builder
+	err := DownloadFile(srv.URL+"/image.iso", Options{OutputDir: dir}, logger.NewLogger(&out))
+	if !errors.Is(err, util.ErrInsufficientSpace) {
+		t.Fatalf("DownloadFile = %v, want ErrInsufficientSpace", err)
+	}
+	if !strings.Contains(out.String(), "insufficient space on "+dir) || !strings.Contains(out.String(), fmt.Sprintf("need %d bytes", int64(1<<60))) {
+		t.Errorf("log does not report the shortage:\n%s", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "image.iso")); !os.IsNotExist(err) {
+		t.Error("a file was created despite the shortage")
+	}
+}
+
+// fullSink is a Sink whose files fail every write with ENOSPC.
+type fullSink struct{}
+
+func (fullSink) Create(name string) (SinkFile, error) { return fullFile{}, nil }
+func (fullSink) Location(name string) string          { return "full:" + name }
+func (fullSink) Close() error                         { return nil }
+
+type fullFile struct{}
+
+func (fullFile) Write(p []byte) (int, error) { return 0, syscall.ENOSPC }
+func (fullFile) Close() error                { return nil }
+func (fullFile) Discard()                    {}
+
+func TestDownloadFileSinkFull(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "payload")
+	}))
+	defer srv.Close()
+
+	err := DownloadFile(srv.URL+"/image.iso", Options{sink: fullSink{}}, logger.NewLogger(io.Discard))
+	if !errors.Is(err, util.ErrInsufficientSpace) || !strings.Contains(err.Error(), "insufficient space on full:image.iso") {
+		t.Errorf("DownloadFile = %v, want insufficient space on the sink's target", err)
+	}
+}
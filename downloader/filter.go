@@ -0,0 +1,51 @@
+package downloader
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/jesee-kuya/wget/util"
+)
+
+// htmlExtensions are the file extensions that may hold a page worth
+// scanning for links even when the file itself is not wanted.
+var htmlExtensions = map[string]bool{
+	"": true, ".html": true, ".htm": true, ".xhtml": true, ".shtml": true,
+	".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true,
+}
+
+// fileAccepted reports whether -A, -R, --accept-regex and --reject-regex let
+// the file at u be saved. The regexes see the whole URL, query included.
+func fileAccepted(u *url.URL, opts Options) bool {
+	if len(opts.Accept) > 0 && !util.MatchFile(u.Path, opts.Accept, opts.IgnoreCase) {
+		return false
+	}
+	if util.MatchFile(u.Path, opts.Reject, opts.IgnoreCase) {
+		return false
+	}
+	if opts.AcceptRegex != nil && !opts.AcceptRegex.MatchString(u.String()) {
+		return false
+	}
+	if opts.RejectRegex != nil && opts.RejectRegex.MatchString(u.String()) {
+		return false
+	}
+	return true
+}
+
+// dirAllowed reports whether -I and -X let the crawl into u's directory.
+func dirAllowed(u *url.URL, opts Options) bool {
+	if len(opts.Include) > 0 && !util.MatchDir(u.Path, opts.Include, opts.IgnoreCase) {
+		return false
+	}
+	return !util.MatchDir(u.Path, opts.Exclude, opts.IgnoreCase)
+}
+
+// mayBeHTML reports whether u may name an HTML page, judging by its
+// extension, so a rejected URL is still fetched to follow its links.
+func mayBeHTML(u *url.URL) bool {
+	if strings.HasSuffix(u.Path, "/") {
+		return true
+	}
+	return htmlExtensions[strings.ToLower(path.Ext(u.Path))]
+}
@@ -0,0 +1,154 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/jesee-kuya/wget/ftp"
+)
+
+// ftpConnect opens and logs in an FTP control connection for u. Credentials
+// come from the URL, then --ftp-user/--ftp-password, then anonymous login.
+// ftps:// URLs use explicit FTPS (AUTH TLS).
+func ftpConnect(u *url.URL, opts Options) (*ftp.Conn, error) {
+	// --unix-socket only applies to HTTP
+	opts.UnixSocket = ""
+	d, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := ftp.Config{Dial: d.DialContext, Active: opts.NoPassiveFTP}
+	if u.Scheme == "ftps" {
+		cfg.TLS = &tls.Config{
+			ServerName:         u.Hostname(),
+			ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		}
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	conn, err := ftp.Dial(addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	user, password := "anonymous", "wget@"
+	if opts.FTPUser != "" {
+		user, password = opts.FTPUser, opts.FTPPassword
+	}
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+
+	if err := conn.Login(user, password); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// ftpPath converts a URL path to a path relative to the login directory,
+// as RFC 1738 specifies for ftp:// URLs.
+func ftpPath(u *url.URL) string {
+	p := path.Clean("/" + u.Path)[1:]
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// openFTP starts retrieving u, resuming with REST when offset > 0.
+func openFTP(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	conn, err := ftpConnect(u, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	p := ftpPath(u)
+	size, err := conn.Size(p)
+	if err != nil {
+		size = -1
+	}
+
+	if size >= 0 && offset >= size {
+		// The local file is already complete.
+		conn.Quit()
+		return &Resource{Body: io.NopCloser(strings.NewReader("")), Status: "file already fully retrieved", Size: 0, Offset: offset}, nil
+	}
+
+	body, err := conn.Retr(p, offset)
+	if err != nil {
+		conn.Quit()
+		return nil, err
+	}
+
+	if size >= 0 {
+		size -= offset
+	}
+	return &Resource{
+		Body:   &ftpBody{ReadCloser: body, conn: conn},
+		Status: "150 Opening BINARY mode data connection",
+		Size:   size,
+		Offset: offset,
+	}, nil
+}
+
+// ftpBody ends the FTP session once the transfer has been closed.
+type ftpBody struct {
+	io.ReadCloser
+	conn   *ftp.Conn
+	closed bool
+}
+
+// Close may be called more than once; only the first call finishes the
+// transfer and quits.
+func (b *ftpBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	err := b.ReadCloser.Close()
+	b.conn.Quit()
+	return err
+}
+
+// ftpFetcher retrieves ftp:// and ftps:// URLs.
+type ftpFetcher struct{}
+
+func (ftpFetcher) Fetch(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	return openFTP(u, offset, opts)
+}
+
+// List implements Lister using the server's LIST output.
+func (ftpFetcher) List(u *url.URL, opts Options) ([]Entry, error) {
+	conn, err := ftpConnect(u, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Quit()
+
+	dir := ftpPath(u)
+	listing, err := conn.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(listing))
+	for _, e := range listing {
+		child := *u
+		child.Path = "/" + path.Join(dir, e.Name)
+		entries = append(entries, Entry{URL: &child, Dir: e.Type == ftp.EntryDir, Size: e.Size})
+	}
+	return entries, nil
+}
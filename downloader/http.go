@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// errNoRanges is returned by openHTTPRange when the server answers a range
+// request with the whole file.
+var errNoRanges = errors.New("server does not support ranged downloads")
+
+// openHTTP issues a GET for u, asking for a byte range when resuming.
+func openHTTP(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	return openHTTPRange(u, offset, -1, opts)
+}
+
+// openHTTPRange issues a GET for bytes start to end, inclusive, of u. With
+// a negative end the range is open-ended and only requested when start is
+// past 0, and a 200 reply restarts from the beginning; with a bounded range
+// a 200 reply fails with errNoRanges unless the whole file is exactly the
+// range asked for.
+func openHTTPRange(u *url.URL, start, end int64, opts Options) (*Resource, error) {
+	client, err := webClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	switch {
+	case end >= 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	case start > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+
+	remoteIP := func() string { return "" }
+	if opts.warc != nil {
+		req, remoteIP = traceRemoteIP(req)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// A file of a single piece may come back whole, which is just as good
+	if end >= 0 && resp.StatusCode == http.StatusOK && (start > 0 || resp.ContentLength != end+1) {
+		resp.Body.Close()
+		return nil, errNoRanges
+	}
+
+	if opts.warc != nil {
+		body, err := newWARCBody(resp, remoteIP, opts.warc)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = body
+	}
+
+	return responseResource(resp, u, start)
+}
+
+// responseResource turns a GET response, possibly to a range request starting
+// at offset, into a Resource.
+func responseResource(resp *http.Response, u *url.URL, offset int64) (*Resource, error) {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		// Full body, either requested or the server ignored the range.
+		offset = 0
+	case resp.StatusCode == http.StatusPartialContent:
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The local file is already complete.
+		resp.Body.Close()
+		resp.Body = http.NoBody
+		resp.ContentLength = 0
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("bad status from: %s, status code: %d", u, resp.StatusCode)
+	}
+
+	return &Resource{
+		Body:        resp.Body,
+		Status:      fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)),
+		Size:        resp.ContentLength,
+		Offset:      offset,
+		ContentType: resp.Header.Get("Content-Type"),
+	}, nil
+}
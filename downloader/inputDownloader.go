@@ -2,6 +2,7 @@ package downloader
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -10,6 +11,9 @@ import (
 	"github.com/jesee-kuya/wget/logger"
 )
 
+// maxInputDownloads is the number of -i URLs downloaded at once.
+const maxInputDownloads = 4
+
 // DownloadInput reads URLs from opt.InputFile and downloads each via DownloadFile.
 // Progress/logging is delegated to the shared logger.
 func DownloadInput(opt Options, log *logger.Logger) {
@@ -19,17 +23,74 @@ func DownloadInput(opt Options, log *logger.Logger) {
 		return
 	}
 
+	if opt.quota == nil {
+		opt.quota = newQuota(opt.Quota)
+	}
+	closeReplay, err := openReplay(&opt)
+	if err != nil {
+		fmt.Fprintf(log.Output, "Error opening WARC file: %v\n", err)
+		return
+	}
+	defer closeReplay()
+
+	if opt.client == nil {
+		opt.client, err = newHTTPClient(opt)
+		if err != nil {
+			fmt.Fprintf(log.Output, "Error setting up connections: %v\n", err)
+			return
+		}
+	}
+
+	closeSink, err := openSink(&opt)
+	if err != nil {
+		fmt.Fprintf(log.Output, "Error opening output sink: %v\n", err)
+		return
+	}
+	defer func() {
+		if err := closeSink(); err != nil {
+			fmt.Fprintf(log.Output, "Error closing output sink: %v\n", err)
+		}
+	}()
+
+	closeWARC, err := openWARC(&opt)
+	if err != nil {
+		fmt.Fprintf(log.Output, "Error opening WARC file: %v\n", err)
+		return
+	}
+	defer func() {
+		if err := closeWARC(); err != nil {
+			fmt.Fprintf(log.Output, "Error closing WARC file: %v\n", err)
+		}
+	}()
+
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	var completedURLs []string
 
+	// Bounding the downloads in flight lets -Q see the bytes of finished
+	// ones before the next URL is started.
+	slots := make(chan struct{}, maxInputDownloads)
 	for _, url := range urls {
+		slots <- struct{}{}
+		if opt.quota.Exceeded() {
+			<-slots
+			log.Skipped(url, ErrQuotaExceeded.Error())
+			continue
+		}
+
 		wg.Add(1)
 		go func(u string) {
-			defer wg.Done()
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
 
 			// For each URL, we reuse DownloadFile to handle fetching, buffering, progress, etc.
 			err := DownloadFile(u, opt, log)
+			if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrFileTooLarge) {
+				// Already reported by DownloadFile as skipped
+				return
+			}
 			if err != nil {
 				fmt.Fprintf(log.Output, "Error downloading %s: %v\n", u, err)
 				return
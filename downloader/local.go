@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openFile opens a file:// URL from the local filesystem. Only local hosts
+// ("" or "localhost") are accepted.
+func openFile(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	if u.Host != "" && u.Host != "localhost" {
+		return nil, fmt.Errorf("file URL %s refers to remote host %q", u, u.Host)
+	}
+
+	f, err := os.Open(filepath.FromSlash(u.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, fmt.Errorf("%s is a directory", u.Path)
+	}
+
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &Resource{
+		Body:        f,
+		Status:      "opened local file",
+		Size:        info.Size() - offset,
+		Offset:      offset,
+		ContentType: mime.TypeByExtension(filepath.Ext(u.Path)),
+	}, nil
+}
+
+// openData decodes an RFC 2397 data: URL, e.g. "data:text/plain;base64,SGk=".
+func openData(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	raw := u.Opaque
+	if raw == "" {
+		// Tolerate "data://..." style URLs that were parsed hierarchically
+		raw = strings.TrimPrefix(u.String(), u.Scheme+":")
+	}
+
+	meta, payload, ok := strings.Cut(raw, ",")
+	if !ok {
+		return nil, fmt.Errorf("malformed data URL: missing ','")
+	}
+
+	decoded, err := url.PathUnescape(payload)
+	if err != nil {
+		return nil, fmt.Errorf("malformed data URL: %w", err)
+	}
+
+	contentType := meta
+	if strings.HasSuffix(strings.ToLower(meta), ";base64") {
+		contentType = meta[:len(meta)-len(";base64")]
+		decoded = strings.Join(strings.Fields(decoded), "")
+		b, err := base64.StdEncoding.DecodeString(decoded)
+		if err != nil {
+			b, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(decoded, "="))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed data URL: %w", err)
+		}
+		decoded = string(b)
+	}
+	if contentType == "" || strings.HasPrefix(contentType, ";") {
+		contentType = "text/plain" + contentType
+		if !strings.Contains(contentType, "charset=") {
+			contentType += ";charset=US-ASCII"
+		}
+	}
+
+	if offset > int64(len(decoded)) {
+		offset = int64(len(decoded))
+	}
+
+	return &Resource{
+		Body:        io.NopCloser(strings.NewReader(decoded[offset:])),
+		Status:      "decoded data URL",
+		Size:        int64(len(decoded)) - offset,
+		Offset:      offset,
+		ContentType: contentType,
+	}, nil
+}
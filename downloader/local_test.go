@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jesee-kuya/wget/logger"
+)
+
+func TestOpenFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "cache.tar")
+	if err := os.WriteFile(src, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(src)}).String()
+
+	tests := []struct {
+		name       string
+		rawURL     string
+		offset     int64
+		wantBody   string
+		wantOffset int64
+		wantErr    bool
+	}{
+		{name: "whole file", rawURL: fileURL, wantBody: "0123456789"},
+		{name: "resume", rawURL: fileURL, offset: 4, wantBody: "456789", wantOffset: 4},
+		{name: "resume complete file", rawURL: fileURL, offset: 12, wantBody: "", wantOffset: 10},
+		{name: "localhost", rawURL: "file://localhost" + filepath.ToSlash(src), wantBody: "0123456789"},
+		{name: "remote host", rawURL: "file://fileserver" + filepath.ToSlash(src), wantErr: true},
+		{name: "directory", rawURL: (&url.URL{Scheme: "file", Path: filepath.ToSlash(dir)}).String(), wantErr: true},
+		{name: "missing", rawURL: fileURL + ".missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := openFile(u, tt.offset, Options{})
+			if tt.wantErr {
+				if err == nil {
+					res.Body.Close()
+					t.Fatal("openFile succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.wantBody || res.Offset != tt.wantOffset || res.Size != int64(len(tt.wantBody)) {
+				t.Errorf("got %q at offset %d, size %d; want %q at offset %d", body, res.Offset, res.Size, tt.wantBody, tt.wantOffset)
+			}
+		})
+	}
+
+	// -c appends the rest of the source to a partial copy
+	out := t.TempDir()
+	if err := os.WriteFile(filepath.Join(out, "cache.tar"), []byte("0123"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := DownloadFile(fileURL, Options{OutputDir: out, Continue: true}, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "cache.tar")); string(got) != "0123456789" {
+		t.Errorf("resumed file = %q", got)
+	}
+}
+
+func TestOpenData(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawURL   string
+		offset   int64
+		wantBody string
+		wantType string
+		wantErr  bool
+	}{
+		{name: "base64", rawURL: "data:text/plain;base64,SGVsbG8sIFdvcmxkIQ==", wantBody: "Hello, World!", wantType: "text/plain"},
+		{name: "base64 without padding", rawURL: "data:;base64,SGk", wantBody: "Hi", wantType: "text/plain;charset=US-ASCII"},
+		{name: "base64 with whitespace", rawURL: "data:application/octet-stream;BASE64,SGVs%20bG8=", wantBody: "Hello", wantType: "application/octet-stream"},
+		{name: "percent-encoded", rawURL: "data:,Hello%2C%20World%21", wantBody: "Hello, World!", wantType: "text/plain;charset=US-ASCII"},
+		{name: "charset kept", rawURL: "data:;charset=utf-8,caf%C3%A9", wantBody: "café", wantType: "text/plain;charset=utf-8"},
+		{name: "resume", rawURL: "data:text/csv,a%2Cb%0A1%2C2", offset: 4, wantBody: "1,2", wantType: "text/csv"},
+		{name: "missing comma", rawURL: "data:text/plain;base64", wantErr: true},
+		{name: "bad base64", rawURL: "data:;base64,!!!", wantErr: true},
+		{name: "bad escape", rawURL: "data:,100%zz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := openData(u, tt.offset, Options{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("openData succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.wantBody || res.ContentType != tt.wantType || res.Offset != tt.offset {
+				t.Errorf("got %q (%s) at offset %d, want %q (%s)", body, res.ContentType, res.Offset, tt.wantBody, tt.wantType)
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/metalink"
+	"github.com/jesee-kuya/wget/util"
+)
+
+// maxMetalinkSize bounds the Metalink documents that are read into memory.
+const maxMetalinkSize = 4 << 20
+
+// isMetalink reports whether contentType announces a Metalink v4 document.
+func isMetalink(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == metalink.MediaType
+}
+
+// DownloadMetalink downloads every file described by the Metalink v4
+// document at source, which is a URL or a local .meta4 file. Each file is
+// fetched from its mirrors in order of preference, falling back to the next
+// mirror on failure, and is only saved once its hashes check out.
+func DownloadMetalink(source string, opts Options, log *logger.Logger) error {
+	if opts.quota == nil {
+		opts.quota = newQuota(opts.Quota)
+	}
+
+	closeSink, err := openSink(&opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeSink(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	closeWARC, err := openWARC(&opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeWARC(); err != nil {
+			log.Error(err)
+		}
+	}()
+
+	closeReplay, err := openReplay(&opts)
+	if err != nil {
+		return err
+	}
+	defer closeReplay()
+
+	var doc io.ReadCloser
+	if u, err := url.Parse(source); err == nil && len(u.Scheme) > 1 {
+		res, err := openResource(u, 0, opts)
+		if err != nil {
+			return err
+		}
+		doc = res.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		doc = f
+	}
+	m, err := metalink.Parse(io.LimitReader(doc, maxMetalinkSize))
+	doc.Close()
+	if err != nil {
+		return err
+	}
+
+	return downloadMetalink(m, opts, log)
+}
+
+// downloadMetalink retrieves the files of m, continuing past failed files.
+func downloadMetalink(m *metalink.Metalink, opts Options, log *logger.Logger) error {
+	// Mirrors may serve Metalink documents themselves; never follow those
+	opts.noMetalink = true
+	if opts.client == nil {
+		client, err := newHTTPClient(opts)
+		if err != nil {
+			return err
+		}
+		opts.client = client
+	}
+
+	var errs []error
+	for _, f := range m.Files {
+		// Names come from the document, so they are restricted like any
+		// URL-derived name; -O is taken as given
+		name := opts.RestrictFileNames.Path(f.Name)
+		if opts.OutputName != "" && len(m.Files) == 1 {
+			name = opts.OutputName
+		}
+		if err := downloadMetalinkFile(&f, name, opts, log); err != nil {
+			if errors.Is(err, ErrQuotaExceeded) {
+				return err
+			}
+			log.Error(err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d metalink files failed", len(errs), len(m.Files))
+	}
+	return nil
+}
+
+// downloadMetalinkFile fetches f into a temporary file, verifies it and then
+// stores it as name in the output sink.
+func downloadMetalinkFile(f *metalink.File, name string, opts Options, log *logger.Logger) error {
+	if opts.quota.Exceeded() {
+		log.Skipped(f.Name, ErrQuotaExceeded.Error())
+		return ErrQuotaExceeded
+	}
+	if opts.MaxFileSize > 0 && f.Size > opts.MaxFileSize {
+		log.Skipped(f.Name, fmt.Sprintf("size %s exceeds --max-filesize %s",
+			util.ContentSize(f.Size), util.ContentSize(opts.MaxFileSize)))
+		return nil
+	}
+
+	log.Start(f.Name, time.Now())
+	total := f.Size
+	if total == 0 {
+		total = -1
+	}
+	log.ContentInfo(total)
+
+	tmp, err := os.CreateTemp("", "wget-metalink-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	var written atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reportProgress(&written, total, stop, log)
+	}()
+
+	mirrors := f.Mirrors(opts.PreferredLocation)
+	if opts.MetalinkParallel > 1 && f.PieceHashes() && f.Size > 0 {
+		err = fetchPieces(f, mirrors, tmp, &written, opts, log)
+	} else {
+		err = fetchFromMirrors(f, mirrors, tmp, &written, opts, log)
+	}
+	close(stop)
+	wg.Wait()
+	if errors.Is(err, ErrFileTooLarge) {
+		log.Skipped(f.Name, fmt.Sprintf("streamed size exceeds --max-filesize %s", util.ContentSize(opts.MaxFileSize)))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Store the verified file
+	outputPath, err := util.JoinWithin(opts.OutputDir, name)
+	if err != nil {
+		return err
+	}
+	var out SinkFile
+	if local, ok := opts.sink.(*dirSink); ok {
+		dir, err := util.ProcessDirectoryPath(local.path(opts.OutputDir), true, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to process output directory: %w", err)
+		}
+		outputPath, err = util.JoinWithin(dir, name)
+		if err != nil {
+			return err
+		}
+		out, err = (&dirSink{}).Create(outputPath)
+		if err != nil {
+			return err
+		}
+		log.SavingTo(outputPath)
+	} else {
+		out, err = opts.sink.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		log.SavingTo(opts.sink.Location(outputPath))
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		out.Discard()
+		return err
+	}
+	if _, err := io.Copy(out, tmp); err != nil {
+		out.Discard()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	log.Done(time.Now(), f.Name)
+	return nil
+}
+
+// reportProgress logs the bytes counted in written until stop is closed.
+func reportProgress(written *atomic.Int64, total int64, stop <-chan struct{}, log *logger.Logger) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	start := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			n := written.Load()
+			speed := float64(n) / time.Since(start).Seconds()
+			var eta time.Duration
+			if speed > 0 && total > 0 {
+				eta = time.Duration(float64(total-n)/speed) * time.Second
+			}
+			log.Progress(n, total, speed, eta)
+		case <-stop:
+			n := written.Load()
+			log.Progress(n, total, float64(n)/time.Since(start).Seconds(), 0)
+			return
+		}
+	}
+}
+
+// fetchFromMirrors downloads the whole file from one mirror after another
+// until a copy passes verification.
+func fetchFromMirrors(f *metalink.File, mirrors []metalink.URL, out *os.File, written *atomic.Int64, opts Options, log *logger.Logger) error {
+	for _, m := range mirrors {
+		if opts.quota.Exceeded() {
+			return ErrQuotaExceeded
+		}
+
+		written.Store(0)
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		err := fetchMirror(m.URL, f.Size, out, written, opts, log)
+		if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrFileTooLarge) {
+			return err
+		}
+		if err == nil {
+			err = verifyMetalinkFile(f, out)
+		}
+		if err == nil {
+			return nil
+		}
+		log.Error(fmt.Errorf("mirror %s failed: %w", m.URL, err))
+	}
+	return fmt.Errorf("%s: no mirror delivered a valid copy", f.Name)
+}
+
+// fetchPieces downloads f's pieces concurrently with opts.MetalinkParallel
+// workers. Each worker starts on a different mirror and moves on to the
+// next one when a piece fails or does not match its hash.
+func fetchPieces(f *metalink.File, mirrors []metalink.URL, out *os.File, written *atomic.Int64, opts Options, log *logger.Logger) error {
+	pieceLen := f.Pieces.Length
+	count := int((f.Size + pieceLen - 1) / pieceLen)
+	if count != len(f.Pieces.Hashes) {
+		return fmt.Errorf("%s: %d piece hashes for %d pieces", f.Name, len(f.Pieces.Hashes), count)
+	}
+	if err := out.Truncate(f.Size); err != nil {
+		return err
+	}
+
+	pieces := make(chan int, count)
+	for i := 0; i < count; i++ {
+		pieces <- i
+	}
+	close(pieces)
+
+	workers := min(opts.MetalinkParallel, count)
+	log.Reply(fmt.Sprintf("fetching %d pieces from %d mirrors with %d connections", count, len(mirrors), workers))
+
+	var failed atomic.Bool
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			for i := range pieces {
+				if failed.Load() {
+					break
+				}
+				if err := fetchPiece(f, i, mirrors, w, out, written, opts); err != nil {
+					failed.Store(true)
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+
+	var firstErr error
+	for w := 0; w < workers; w++ {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if _, err := out.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return f.Verify(out)
+}
+
+// fetchPiece downloads piece i, trying the mirrors in turn starting with the
+// worker's own.
+func fetchPiece(f *metalink.File, i int, mirrors []metalink.URL, worker int, out *os.File, written *atomic.Int64, opts Options) error {
+	start := int64(i) * f.Pieces.Length
+	length := min(f.Pieces.Length, f.Size-start)
+	buf := make([]byte, length)
+
+	var lastErr error
+	for k := range mirrors {
+		if opts.quota.Exceeded() {
+			return ErrQuotaExceeded
+		}
+		m := mirrors[(worker+k)%len(mirrors)]
+
+		lastErr = readMirrorRange(m.URL, start, buf, opts)
+		if lastErr == nil {
+			lastErr = f.VerifyPiece(i, buf)
+		}
+		if lastErr != nil {
+			lastErr = fmt.Errorf("mirror %s: %w", m.URL, lastErr)
+			continue
+		}
+
+		if _, err := out.WriteAt(buf, start); err != nil {
+			return err
+		}
+		written.Add(length)
+		return nil
+	}
+	return fmt.Errorf("%s: piece %d: no mirror delivered a valid copy: %w", f.Name, i, lastErr)
+}
+
+// readMirrorRange fills buf with the bytes of rawURL starting at offset.
+// HTTP mirrors are asked for exactly those bytes; other protocols resume at
+// offset and the transfer is cut short once buf is full.
+func readMirrorRange(rawURL string, offset int64, buf []byte, opts Options) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	var res *Resource
+	if u.Scheme == "http" || u.Scheme == "https" {
+		res, err = openHTTPRange(u, offset, offset+int64(len(buf))-1, opts)
+	} else {
+		res, err = openResource(u, offset, opts)
+	}
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.Offset != offset {
+		return errNoRanges
+	}
+
+	n, err := io.ReadFull(res.Body, buf)
+	opts.quota.Add(int64(n))
+	return err
+}
+
+// fetchMirror streams rawURL into out, counting the bytes in written. size
+// is the expected file size, 0 if unknown.
+func fetchMirror(rawURL string, size int64, out *os.File, written *atomic.Int64, opts Options, log *logger.Logger) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	res, err := openResource(u, 0, opts)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	log.Reply(res.Status)
+
+	if size > 0 && res.Size >= 0 && res.Size != size {
+		return fmt.Errorf("size %d differs from the metalink's %d", res.Size, size)
+	}
+
+	if err := copyBody(io.NewOffsetWriter(out, 0), res.Body, 0, written, opts); err != nil {
+		return err
+	}
+
+	// Closing the body writes the exchange to --warc-file, if any
+	return res.Body.Close()
+}
+
+// verifyMetalinkFile checks a complete download against f's size, piece
+// hashes and whole-file hash.
+func verifyMetalinkFile(f *metalink.File, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if f.Size > 0 && info.Size() != f.Size {
+		return fmt.Errorf("got %d bytes, want %d", info.Size(), f.Size)
+	}
+
+	if f.PieceHashes() {
+		buf := make([]byte, f.Pieces.Length)
+		for i := 0; int64(i)*f.Pieces.Length < info.Size(); i++ {
+			n, err := file.ReadAt(buf, int64(i)*f.Pieces.Length)
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if err := f.VerifyPiece(i, buf[:n]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return f.Verify(file)
+}
@@ -0,0 +1,237 @@
+package downloader
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/util"
+	"github.com/jesee-kuya/wget/warc"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestMetalinkFailoverAndPieces(t *testing.T) {
+	content := strings.Repeat("release artifact ", 1000)
+	const pieceLen = 4096
+
+	var mu sync.Mutex
+	ranges := make(map[string]bool)
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges[r.Header.Get("Range")] = true
+		mu.Unlock()
+		http.ServeContent(w, r, "tool.tar.gz", time.Time{}, strings.NewReader(content))
+	}))
+	defer good.Close()
+	corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "tool.tar.gz", time.Time{}, strings.NewReader(strings.ToUpper(content)))
+	}))
+	defer corrupt.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var pieces strings.Builder
+	for off := 0; off < len(content); off += pieceLen {
+		fmt.Fprintf(&pieces, "<hash>%s</hash>", sha256Hex(content[off:min(off+pieceLen, len(content))]))
+	}
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="tool.tar.gz">
+    <size>%d</size>
+    <hash type="sha-256">%s</hash>
+    <pieces length="%d" type="sha-256">%s</pieces>
+    <url priority="1">%s/tool.tar.gz</url>
+    <url priority="2">%s/tool.tar.gz</url>
+    <url priority="3">%s/tool.tar.gz</url>
+  </file>
+</metalink>`, len(content), sha256Hex(content), pieceLen, pieces.String(), down.URL, corrupt.URL, good.URL)
+
+	docPath := filepath.Join(t.TempDir(), "tool.meta4")
+	if err := os.WriteFile(docPath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger(io.Discard)
+	for _, parallel := range []int{1, 3} {
+		out := t.TempDir()
+		opts := Options{OutputDir: out, MetalinkParallel: parallel}
+		if err := DownloadMetalink(docPath, opts, log); err != nil {
+			t.Fatalf("parallel=%d: %v", parallel, err)
+		}
+		got, err := os.ReadFile(filepath.Join(out, "tool.tar.gz"))
+		if err != nil || string(got) != content {
+			t.Errorf("parallel=%d: downloaded %d bytes, %v", parallel, len(got), err)
+		}
+	}
+
+	// Pieces are asked for exactly, piece 0 included
+	for off := 0; off < len(content); off += pieceLen {
+		want := fmt.Sprintf("bytes=%d-%d", off, min(off+pieceLen, len(content))-1)
+		if !ranges[want] {
+			t.Errorf("no piece request with Range: %s, got %v", want, ranges)
+		}
+	}
+
+	// A mirror that answers a range request with the whole file cannot
+	// serve pieces
+	whole := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		io.WriteString(w, content)
+	}))
+	defer whole.Close()
+	if err := readMirrorRange(whole.URL, 0, make([]byte, pieceLen), Options{}); !errors.Is(err, errNoRanges) {
+		t.Errorf("readMirrorRange from a server without ranges = %v, want errNoRanges", err)
+	}
+	// unless the whole file is the range asked for
+	buf := make([]byte, len(content))
+	if err := readMirrorRange(whole.URL, 0, buf, Options{}); err != nil || string(buf) != content {
+		t.Errorf("readMirrorRange of the whole file = %v", err)
+	}
+
+	// A document served over HTTP is recognised by its Content-Type
+	docServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/metalink4+xml")
+		io.WriteString(w, doc)
+	}))
+	defer docServer.Close()
+	out := t.TempDir()
+	if err := DownloadFile(docServer.URL+"/tool.meta4", Options{OutputDir: out}, log); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "tool.tar.gz")); string(got) != content {
+		t.Errorf("auto-detected metalink downloaded %d bytes", len(got))
+	}
+}
+
+func TestMetalinkRestrictsFileNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "notes")
+	}))
+	defer srv.Close()
+
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="Docs/Release:1.0?.TXT">
+    <hash type="sha-256">%s</hash>
+    <url>%s/notes.txt</url>
+  </file>
+</metalink>`, sha256Hex("notes"), srv.URL)
+	docPath := filepath.Join(t.TempDir(), "notes.meta4")
+	if err := os.WriteFile(docPath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := t.TempDir()
+	opts := Options{OutputDir: out, RestrictFileNames: util.FileNameRules{Windows: true, Lowercase: true}}
+	if err := DownloadMetalink(docPath, opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(out, "docs", "release%3A1.0%3F.txt")); err != nil || string(got) != "notes" {
+		t.Errorf("restricted name: %q, %v", got, err)
+	}
+}
+
+func TestMetalinkWARC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "mirrored")
+	}))
+
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="mirrored.txt">
+    <hash type="sha-256">%s</hash>
+    <url>%s/mirrored.txt</url>
+  </file>
+</metalink>`, sha256Hex("mirrored"), srv.URL)
+	dir := t.TempDir()
+	docPath := filepath.Join(dir, "mirrored.meta4")
+	if err := os.WriteFile(docPath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	log := logger.NewLogger(io.Discard)
+	name := filepath.Join(dir, "capture")
+	if err := DownloadMetalink(docPath, Options{OutputDir: t.TempDir(), WARCFile: name}, log); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	// The archive holds the mirror's response
+	a, err := warc.Open(name + ".warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: a}).Get(srv.URL + "/mirrored.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Close()
+	if string(body) != "mirrored" {
+		t.Errorf("archived body = %q", body)
+	}
+
+	// and --from-warc replays it with the mirror gone
+	out := t.TempDir()
+	if err := DownloadMetalink(docPath, Options{OutputDir: out, FromWARC: name + ".warc.gz"}, log); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(out, "mirrored.txt")); err != nil || string(got) != "mirrored" {
+		t.Errorf("replayed file: %q, %v", got, err)
+	}
+}
+
+func TestMetalinkMaxFileSize(t *testing.T) {
+	content := strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, content)
+	}))
+	defer srv.Close()
+
+	// Without a <size> the limit is only hit while streaming
+	doc := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="big.bin">
+    <hash type="sha-256">%s</hash>
+    <url>%s/big.bin</url>
+  </file>
+</metalink>`, sha256Hex(content), srv.URL)
+	docPath := filepath.Join(t.TempDir(), "big.meta4")
+	if err := os.WriteFile(docPath, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	out := t.TempDir()
+	if err := DownloadMetalink(docPath, Options{OutputDir: out, MaxFileSize: 1024}, logger.NewLogger(&buf)); err != nil {
+		t.Fatalf("oversized file counted as a failure: %v", err)
+	}
+	if !strings.Contains(buf.String(), "skipping big.bin: streamed size exceeds --max-filesize") {
+		t.Errorf("log does not report the skip:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "error:") {
+		t.Errorf("log reports an error:\n%s", buf.String())
+	}
+	if _, err := os.Stat(filepath.Join(out, "big.bin")); !os.IsNotExist(err) {
+		t.Errorf("oversized file was saved: %v", err)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -18,115 +19,416 @@ import (
 )
 
 // MirrorSite recursively downloads all pages and assets starting from `startURL`.
-// All files are saved under a folder named after the domain (e.g., "www.example.com").
-// It uses parser.ExtractLinks to find internal <a>, <link>, and <img> references.
+// All files are saved under a folder named after the domain (e.g., "www.example.com"),
+// one per host when opts.SpanHosts or opts.Domains let the crawl leave the start host.
+// It uses parser.ExtractPage to find <a>, <link>, <img> and other references.
+// Start URLs whose fetcher implements Lister (e.g. ftp://) are mirrored by walking
+// their directory listings instead. HTTP sites are crawled by opts.MirrorWorkers
+// workers at once (see crawler), following links at most opts.MaxDepth deep.
 func MirrorSite(startURL string, opts Options, log *logger.Logger) error {
 	base, err := url.Parse(startURL)
 	if err != nil {
 		return fmt.Errorf("invalid start URL %q: %w", startURL, err)
 	}
 
-	visited := make(map[string]bool)
-	var mu sync.Mutex
-
-	queueSlice := []string{startURL}
-	visited[startURL] = true
+	if opts.quota == nil {
+		opts.quota = newQuota(opts.Quota)
+	}
 
-	for len(queueSlice) > 0 {
-		mu.Lock()
-		currentURL := queueSlice[0]
-		queueSlice = queueSlice[1:]
-		mu.Unlock()
+	closeSink, err := openSink(&opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeSink(); err != nil {
+			log.Error(err)
+		}
+	}()
 
-		urlParsed, err := url.Parse(currentURL)
-		if err != nil {
-			log.Error(fmt.Errorf("failed to parse URL %s: %w", currentURL, err))
-			continue
+	closeWARC, err := openWARC(&opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := closeWARC(); err != nil {
+			log.Error(err)
 		}
+	}()
 
-		if util.ShouldReject(urlParsed.Path, opts.Reject) || util.ShouldExclude(urlParsed.Path, opts.Exclude) {
-			continue
+	if base.Scheme != "http" && base.Scheme != "https" {
+		f, ok := fetcherFor(base.Scheme)
+		if !ok {
+			return fmt.Errorf("unsupported URL scheme %q in %s", base.Scheme, base.Redacted())
 		}
+		l, ok := f.(Lister)
+		if !ok {
+			return fmt.Errorf("%s URLs cannot be retrieved recursively", base.Scheme)
+		}
+		return mirrorTree(base, l, opts, log)
+	}
+	closeReplay, err := openReplay(&opts)
+	if err != nil {
+		return err
+	}
+	defer closeReplay()
 
-		log.Start(currentURL, time.Now())
-		resp, err := http.Get(currentURL)
+	if opts.client == nil {
+		opts.client, err = newHTTPClient(opts)
 		if err != nil {
-			log.Error(fmt.Errorf("failed HTTP GET %s: %w", currentURL, err))
-			continue
+			return err
 		}
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			log.Error(fmt.Errorf("bad status for %s: %s", currentURL, resp.Status))
-			resp.Body.Close()
-			continue
-		}
+	newCrawler(base, opts, log).run(startURL)
+	return nil
+}
 
-		saveDir, err := util.CreateURLDirectories(currentURL, opts.OutputDir)
-		if err != nil {
-			log.Error(fmt.Errorf("failed to create folders for %s: %w", currentURL, err))
-			resp.Body.Close()
-			continue
+// visit fetches one URL of the crawl, found depth links away from the
+// start, queues the links of HTML pages and stylesheets and saves the body.
+func (c *crawler) visit(currentURL string, depth int) {
+	opts := c.opts
+	log, flush := c.taskLogger()
+	defer flush()
+
+	urlParsed, err := url.Parse(currentURL)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to parse URL %s: %w", currentURL, err))
+		return
+	}
+
+	// The start page is always fetched; -I and -X only limit where the crawl goes
+	if depth > 0 && !dirAllowed(urlParsed, opts) {
+		return
+	}
+	// A rejected page is still fetched for its links, just not saved
+	save := fileAccepted(urlParsed, opts)
+	if !save && !mayBeHTML(urlParsed) {
+		return
+	}
+
+	if rules := c.robotsFor(urlParsed); rules != nil && !rules.Allowed(urlParsed.RequestURI()) {
+		log.Skipped(currentURL, "disallowed by robots.txt")
+		return
+	}
+
+	if opts.quota.Exceeded() {
+		if c.stop() {
+			log.Skipped(currentURL, ErrQuotaExceeded.Error())
 		}
+		return
+	}
+
+	log.Start(currentURL, time.Now())
+	release := sync.OnceFunc(c.acquireHost(urlParsed))
+	defer release()
 
-		filename := util.ExtractFilenameFromURL(currentURL)
-		outputPath := filepath.Join(saveDir, filename)
-		log.SavingTo(outputPath)
+	req, err := http.NewRequest(http.MethodGet, currentURL, nil)
+	if err != nil {
+		log.Error(fmt.Errorf("failed HTTP GET %s: %w", currentURL, err))
+		return
+	}
+	req.Header.Set("User-Agent", userAgent)
+	remoteIP := func() string { return "" }
+	if opts.warc != nil {
+		req, remoteIP = traceRemoteIP(req)
+	}
+	client, err := webClient(opts)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Error(fmt.Errorf("failed HTTP GET %s: %w", currentURL, err))
+		return
+	}
 
-		bodyBytes, readErr := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Error(fmt.Errorf("bad status for %s: %s", currentURL, resp.Status))
 		resp.Body.Close()
-		if readErr != nil {
-			log.Error(fmt.Errorf("failed to read body %s: %w", currentURL, readErr))
-			continue
+		return
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	isHTML := strings.HasPrefix(contentType, "text/html")
+	isCSS := strings.HasPrefix(contentType, "text/css")
+	if !save && !isHTML {
+		log.Skipped(currentURL, "rejected by the accept/reject rules")
+		resp.Body.Close()
+		return
+	}
+
+	if opts.MaxFileSize > 0 && resp.ContentLength > opts.MaxFileSize {
+		log.Skipped(currentURL, fmt.Sprintf("size %s exceeds --max-filesize %s",
+			util.ContentSize(resp.ContentLength), util.ContentSize(opts.MaxFileSize)))
+		resp.Body.Close()
+		return
+	}
+
+	outputPath, err := mirrorPath(currentURL, opts)
+	if err != nil {
+		log.Error(fmt.Errorf("failed to create folders for %s: %w", currentURL, err))
+		resp.Body.Close()
+		return
+	}
+	if opts.AdjustExtension {
+		outputPath = c.adjustExtension(currentURL, outputPath, contentType)
+	}
+	log.SavingTo(opts.sink.Location(outputPath))
+
+	body := io.Reader(resp.Body)
+	if opts.MaxFileSize > 0 {
+		// Read one byte past the limit so an oversized stream can be detected
+		body = io.LimitReader(resp.Body, opts.MaxFileSize+1)
+	}
+	bodyBytes, readErr := io.ReadAll(body)
+	resp.Body.Close()
+	release()
+	if readErr != nil {
+		log.Error(fmt.Errorf("failed to read body %s: %w", currentURL, readErr))
+		return
+	}
+	opts.quota.Add(int64(len(bodyBytes)))
+
+	if opts.MaxFileSize > 0 && int64(len(bodyBytes)) > opts.MaxFileSize {
+		log.Skipped(currentURL, fmt.Sprintf("streamed size exceeds --max-filesize %s", util.ContentSize(opts.MaxFileSize)))
+		return
+	}
+
+	if opts.warc != nil {
+		if err := opts.warc.WriteExchange(resp.Request, resp, remoteIP(), bytes.NewReader(bodyBytes)); err != nil {
+			log.Error(fmt.Errorf("failed to archive %s: %w", currentURL, err))
 		}
+	}
 
-		// After reading bodyBytes and before writing:
-		contentType := resp.Header.Get("Content-Type")
-		if strings.HasPrefix(contentType, "text/html") {
-			// First pass: parse links into queue
-			reader := bytes.NewReader(bodyBytes)
-			foundLinks, parseErr := parser.ExtractLinks(base, reader)
-			if parseErr != nil {
-				log.Error(fmt.Errorf("failed to parse HTML %s: %w", currentURL, parseErr))
-			} else {
-				for _, link := range foundLinks {
-					mu.Lock()
-					if !visited[link] {
-						visited[link] = true
-						queueSlice = append(queueSlice, link)
-					}
-					mu.Unlock()
-				}
+	// After reading bodyBytes and before writing:
+	if isHTML {
+		// First pass: parse links into queue
+		reader := bytes.NewReader(bodyBytes)
+		page, parseErr := parser.ExtractPage(urlParsed, reader)
+		if parseErr != nil {
+			log.Error(fmt.Errorf("failed to parse HTML %s: %w", currentURL, parseErr))
+		} else {
+			if c.isDuplicate(currentURL, page) {
+				c.enqueue([]string{page.Canonical}, depth)
+				log.Skipped(currentURL, "duplicate of its canonical URL "+page.Canonical)
+				return
 			}
+			links, requisites := c.followable(page)
+			c.enqueue(links, depth+1)
+			c.push(requisites, depth+1)
+		}
+
+		// Without --convert-links, root-relative links are made relative
+		if !opts.ConvertLink {
+			stripped := bytes.ReplaceAll(bodyBytes, []byte("href=\"/"), []byte("href=\""))
+			stripped = bytes.ReplaceAll(stripped, []byte("src=\"/"), []byte("src=\""))
+			stripped = bytes.ReplaceAll(stripped, []byte("url(/"), []byte("url("))
+			bodyBytes = stripped
+		}
+	}
 
-			// Now optionally rewrite links for offline use
-			if opts.ConvertLink {
-				// domainDir: root of this mirror, e.g. opts.OutputDir/<domain>
-				domainDir := filepath.Join(opts.OutputDir, base.Host)
-				htmlDir := filepath.Dir(outputPath)
-				rewritten, err := parser.RewriteLinks(bodyBytes, urlParsed, domainDir, htmlDir)
-				if err != nil {
-					log.Error(fmt.Errorf("rewrite links failed for %s: %w", currentURL, err))
-				} else {
-					bodyBytes = rewritten
-				}
-			} else {
-				stripped := bytes.ReplaceAll(bodyBytes, []byte("href=\"/"), []byte("href=\""))
-				stripped = bytes.ReplaceAll(stripped, []byte("src=\"/"), []byte("src=\""))
-				stripped = bytes.ReplaceAll(stripped, []byte("url(/"), []byte("url("))
-				bodyBytes = stripped
+	// Stylesheets bring in fonts, background images and further stylesheets
+	if isCSS {
+		sheet, parseErr := parser.ExtractStylesheet(urlParsed, bytes.NewReader(bodyBytes))
+		if parseErr != nil {
+			log.Error(fmt.Errorf("failed to parse CSS %s: %w", currentURL, parseErr))
+		} else {
+			links, requisites := c.followable(sheet)
+			c.enqueue(links, depth+1)
+			c.push(requisites, depth+1)
+		}
+	}
+
+	if !save {
+		log.Skipped(currentURL, "rejected by the accept/reject rules, links followed")
+		return
+	}
+
+	// Now optionally rewrite links for offline use
+	if opts.ConvertLink && (isHTML || isCSS) {
+		if opts.AdjustExtension {
+			// Links can only point at -E names once every target's type is known
+			if err := c.deferConversion(urlParsed, outputPath, isCSS, bodyBytes); err != nil {
+				log.Error(fmt.Errorf("failed to save %s for link conversion: %w", currentURL, err))
+				return
 			}
+			log.ContentInfo(int64(len(bodyBytes)))
+			log.Progress(int64(len(bodyBytes)), int64(len(bodyBytes)), 0, 0)
+			log.Done(time.Now(), currentURL)
+			return
+		}
+		rewritten, err := c.convertLinks(urlParsed, outputPath, isCSS, bodyBytes)
+		if err != nil {
+			log.Error(fmt.Errorf("rewrite links failed for %s: %w", currentURL, err))
+		} else {
+			bodyBytes = rewritten
 		}
+	}
+
+	// Finally, write the (possibly rewritten) HTML or asset to the sink:
+	holder, err := c.write(outputPath, currentURL, bodyBytes)
+	if err != nil {
+		log.Error(fmt.Errorf("write failed %s: %w", outputPath, err))
+		return
+	}
+	if holder != currentURL {
+		log.Skipped(currentURL, fmt.Sprintf("%s already holds %s", outputPath, holder))
+		return
+	}
+
+	log.ContentInfo(int64(len(bodyBytes)))
+	log.Progress(int64(len(bodyBytes)), int64(len(bodyBytes)), 0, 0)
+	log.Done(time.Now(), currentURL)
+}
 
-		// Finally, write the (possibly rewritten) HTML or asset to disk:
-		if err := os.WriteFile(outputPath, bodyBytes, 0o644); err != nil {
-			log.Error(fmt.Errorf("write failed %s: %w", outputPath, err))
+// followable returns the links of page the crawl may follow: those on hosts
+// it spans and, with --no-parent, below the start directory, and with
+// robots.txt honoured, none under <meta name="robots" content="nofollow">
+// and never those marked rel="nofollow". With -p, page requisites are
+// returned separately and may come from above the start directory; -p
+// without -r or --mirror follows nothing else.
+func (c *crawler) followable(page *parser.Page) (links, requisites []string) {
+	if !c.opts.IgnoreRobots && page.NoFollow {
+		return nil, nil
+	}
+	pageOnly := c.opts.PageRequisites && !c.opts.Mirror && !c.opts.Recursive
+	for _, l := range page.Links {
+		if !c.opts.IgnoreRobots && l.NoFollow {
+			continue
+		}
+		u, err := url.Parse(l.URL)
+		if err != nil || !c.spans(u) {
 			continue
 		}
+		switch {
+		case c.opts.PageRequisites && l.Requisite:
+			requisites = append(requisites, l.URL)
+		case !pageOnly && c.belowStart(u):
+			links = append(links, l.URL)
+		}
+	}
+	return links, requisites
+}
+
+// spans reports whether the crawl may fetch URLs on u's host: the start host
+// always, other hosts with -H or when listed in -D, unless --exclude-domains
+// matches them.
+func (c *crawler) spans(u *url.URL) bool {
+	host := u.Hostname()
+	if u.Host == c.base.Host {
+		return true
+	}
+	if util.MatchAnyDomain(host, c.opts.ExcludeDomains) {
+		return false
+	}
+	if len(c.opts.Domains) > 0 {
+		return util.MatchAnyDomain(host, c.opts.Domains)
+	}
+	return c.opts.SpanHosts
+}
+
+// belowStart reports whether u is inside the start URL's directory, or on
+// another host, when --no-parent is set. The start directory follows
+// util.URLPath: a start URL such as /docs/v2, without a trailing slash or a
+// file extension, is itself the directory, while /docs/v2/index.html or
+// /docs/v2/page?id=1 names a file in /docs/v2/.
+func (c *crawler) belowStart(u *url.URL) bool {
+	if !c.opts.NoParent || u.Host != c.base.Host {
+		return true
+	}
+	dir := c.base.Path
+	switch {
+	case dir == "":
+		dir = "/"
+	case strings.HasSuffix(dir, "/"):
+	case c.base.RawQuery != "" || util.HasFileExtension(path.Base(dir)):
+		dir = path.Dir(dir) + "/"
+	default:
+		dir += "/"
+	}
+	return strings.HasPrefix(u.Path, dir) || u.Path+"/" == dir
+}
+
+// localPath maps a link to the file the crawl saves it as, for
+// --convert-links. Links the crawl did not queue, or queued but does not
+// save, are left alone. Links to a page known to duplicate its canonical
+// URL point at the canonical page's file.
+func (c *crawler) localPath(u *url.URL) (string, bool) {
+	if !c.isQueued(u.String()) || !dirAllowed(u, c.opts) || !fileAccepted(u, c.opts) {
+		return "", false
+	}
+	// A duplicate page is saved as its canonical one
+	return c.savedPath(c.canonicalOf(u.String()))
+}
+
+// convertLinks rewrites the links of an HTML page or stylesheet saved as
+// outputPath to point at the local copies, for --convert-links.
+func (c *crawler) convertLinks(u *url.URL, outputPath string, css bool, body []byte) ([]byte, error) {
+	if css {
+		return parser.RewriteStylesheet(body, u, filepath.Dir(outputPath), c.localPath), nil
+	}
+	return parser.RewriteLinks(body, u, filepath.Dir(outputPath), c.localPath)
+}
+
+// isDuplicate reports whether, with --canonical, the page at rawURL names
+// another URL the crawl may fetch as its rel="canonical" one, so it is not
+// saved and its canonical page is fetched instead.
+func (c *crawler) isDuplicate(rawURL string, page *parser.Page) bool {
+	if !c.opts.Canonical || page.Canonical == "" || page.Canonical == rawURL {
+		return false
+	}
+	u, err := url.Parse(page.Canonical)
+	if err != nil || !c.spans(u) || !c.belowStart(u) {
+		return false
+	}
+	return c.deferTo(rawURL, page.Canonical)
+}
+
+// adjustExtension appends .html or .css to outputPath, for -E, when the
+// Content-Type says the file is a page or stylesheet but its name does not,
+// and remembers the new name for --convert-links.
+func (c *crawler) adjustExtension(rawURL, outputPath, contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	lower := strings.ToLower(outputPath)
+	adjusted := outputPath
+	switch mediaType {
+	case "text/html", "application/xhtml+xml":
+		if !strings.HasSuffix(lower, ".html") && !strings.HasSuffix(lower, ".htm") {
+			adjusted += ".html"
+		}
+	case "text/css":
+		if !strings.HasSuffix(lower, ".css") {
+			adjusted += ".css"
+		}
+	}
+	if adjusted != outputPath {
+		c.mu.Lock()
+		c.adjusted[rawURL] = adjusted
+		c.mu.Unlock()
+	}
+	return adjusted
+}
 
-		log.ContentInfo(int64(len(bodyBytes)))
-		log.Progress(int64(len(bodyBytes)), int64(len(bodyBytes)), 0, 0)
-		log.Done(time.Now(), currentURL)
+// savedPath returns the file rawURL is saved as: its mirrorPath, or the
+// name -E gave it.
+func (c *crawler) savedPath(rawURL string) (string, bool) {
+	c.mu.Lock()
+	p, ok := c.adjusted[rawURL]
+	c.mu.Unlock()
+	if ok {
+		return p, true
 	}
+	p, err := mirrorPath(rawURL, c.opts)
+	return p, err == nil
+}
 
-	return nil
+// mirrorPath returns where a crawled URL is saved under the output
+// directory, with file names restricted by --restrict-file-names.
+func mirrorPath(rawURL string, opts Options) (string, error) {
+	p, err := util.URLPath(rawURL, opts.RestrictFileNames)
+	if err != nil {
+		return "", err
+	}
+	return util.JoinWithin(opts.OutputDir, p)
 }
@@ -0,0 +1,630 @@
+package downloader
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/util"
+)
+
+// readTree returns the contents of every file under root by relative path.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestMirrorWorkersMatchSequentialCrawl(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/index.html":
+			for i := 0; i < 20; i++ {
+				fmt.Fprintf(w, `<a href="/pages/p%d.html">%d</a>`, i, i)
+			}
+			// Both of these are saved as docs/docs/index.html
+			io.WriteString(w, `<a href="/docs/docs">a</a><a href="/docs/docs/">b</a>`)
+		case "/docs/docs", "/docs/docs/":
+			fmt.Fprintf(w, "<p>%s</p>", r.URL.Path)
+		default:
+			fmt.Fprintf(w, `<p>%s</p><img src="/img/shared.png">`, r.URL.Path)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	log := logger.NewLogger(io.Discard)
+	crawl := func(workers int) map[string]string {
+		out := t.TempDir()
+		opts := Options{OutputDir: out, MirrorWorkers: workers, MirrorHostLimit: 3}
+		if err := MirrorSite(srv.URL+"/index.html", opts, log); err != nil {
+			t.Fatal(err)
+		}
+		return readTree(t, out)
+	}
+
+	want := crawl(1)
+	for run := 0; run < 3; run++ {
+		got := crawl(8)
+		if len(got) != len(want) {
+			t.Fatalf("concurrent crawl wrote %d files, sequential %d", len(got), len(want))
+		}
+		for name, data := range want {
+			if got[name] != data {
+				t.Errorf("%s differs between sequential and concurrent crawls", name)
+			}
+		}
+	}
+
+	u, _ := url.Parse(srv.URL)
+	if got := want[u.Host+"/docs/docs/index.html"]; got != "<p>/docs/docs</p>" {
+		t.Errorf("colliding URLs saved %q, want the body of /docs/docs", got)
+	}
+}
+
+func TestMirrorDepthLimit(t *testing.T) {
+	links := map[string]string{
+		"/index.html": `<a href="/a.html">a</a><a href="/deep1.html">1</a>`,
+		"/a.html":     `<a href="/deep2.html">2</a>`,
+		"/deep1.html": `<a href="/deep2.html">2</a>`,
+		"/deep2.html": `<a href="/deep3.html">3</a>`,
+		"/deep3.html": `end`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, links[r.URL.Path])
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	for _, workers := range []int{1, 4} {
+		out := t.TempDir()
+		opts := Options{OutputDir: out, Recursive: true, MaxDepth: 2, MirrorWorkers: workers}
+		if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+		files := readTree(t, out)
+		if _, ok := files[u.Host+"/deep2.html"]; !ok || len(files) != 4 {
+			t.Errorf("workers=%d: -l 2 saved %d files, want index, a, deep1 and deep2", workers, len(files))
+		}
+	}
+}
+
+func TestMirrorHonoursRobots(t *testing.T) {
+	pages := map[string]string{
+		"/robots.txt":     "User-agent: wget\nDisallow: /private/\n",
+		"/index.html":     `<a href="/private/a.html">p</a><a href="/ads.html" rel="sponsored nofollow">ad</a><a href="/meta.html">m</a>`,
+		"/meta.html":      `<meta name="robots" content="noindex, nofollow"><a href="/hidden.html">h</a>`,
+		"/private/a.html": "secret",
+		"/ads.html":       "ad",
+		"/hidden.html":    "hidden",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path != "/robots.txt" {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	crawl := func(opts Options) map[string]string {
+		opts.OutputDir = t.TempDir()
+		if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+		return readTree(t, opts.OutputDir)
+	}
+
+	files := crawl(Options{Mirror: true})
+	if len(files) != 2 || files[u.Host+"/meta.html"] == "" {
+		t.Errorf("robots-compliant crawl saved %d files, want index.html and meta.html", len(files))
+	}
+
+	files = crawl(Options{Mirror: true, IgnoreRobots: true})
+	if len(files) != 5 {
+		t.Errorf("-e robots=off saved %d files, want 5", len(files))
+	}
+}
+
+func TestMirrorSeedsFromSitemaps(t *testing.T) {
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "Sitemap: %s/sitemap_index.xml.gz\n", srvURL)
+		case "/sitemap_index.xml.gz":
+			gz := gzip.NewWriter(w)
+			fmt.Fprintf(gz, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%s/pages.xml</loc></sitemap></sitemapindex>`, srvURL)
+			gz.Close()
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/js-only.html</loc><lastmod>2001-01-01</lastmod></url>
+<url><loc>https://elsewhere.example/page.html</loc></url></urlset>`, srvURL)
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<script>navigate("/js-only.html")</script>`)
+		case "/js-only.html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, "reached")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+	u, _ := url.Parse(srv.URL)
+
+	out := t.TempDir()
+	opts := Options{OutputDir: out, Mirror: true, Sitemap: true}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, out)[u.Host+"/js-only.html"]; got != "reached" {
+		t.Fatalf("page listed only in the sitemap was not mirrored")
+	}
+
+	// The local copy is newer than lastmod, so an incremental run skips it
+	os.WriteFile(filepath.Join(out, u.Host, "js-only.html"), []byte("kept"), 0o644)
+	opts.SitemapLastMod = true
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, out)[u.Host+"/js-only.html"]; got != "kept" {
+		t.Errorf("--sitemap-lastmod fetched an unmodified page again")
+	}
+}
+
+func TestMirrorSpansHosts(t *testing.T) {
+	var port string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := strings.Cut(r.Host, ":")
+		switch host + r.URL.Path {
+		case "www.example.test/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<script src="x"></script><img src="http://cdn.example.test:%[1]s/logo.png">`+
+				`<a href="http://ads.example.test:%[1]s/ad.html">ad</a><a href="http://other.test:%[1]s/">o</a>`, port)
+		case "cdn.example.test/logo.png", "ads.example.test/ad.html", "other.test/":
+			io.WriteString(w, host)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	_, port, _ = net.SplitHostPort(srv.Listener.Addr().String())
+	resolve := make(map[string]string)
+	for _, h := range []string{"www.example.test", "cdn.example.test", "ads.example.test", "other.test"} {
+		resolve[net.JoinHostPort(h, port)] = "127.0.0.1"
+	}
+	start := "http://www.example.test:" + port + "/index.html"
+
+	crawl := func(opts Options) map[string]string {
+		opts.OutputDir = t.TempDir()
+		opts.Resolve = resolve
+		if err := MirrorSite(start, opts, logger.NewLogger(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+		return readTree(t, opts.OutputDir)
+	}
+
+	if files := crawl(Options{Mirror: true}); len(files) != 1 {
+		t.Errorf("crawl without -H saved %d files, want only the start page", len(files))
+	}
+	if files := crawl(Options{Mirror: true, SpanHosts: true}); len(files) != 4 {
+		t.Errorf("-H saved %d files, want one per host", len(files))
+	}
+
+	files := crawl(Options{Mirror: true, Domains: []string{"*.example.test"}, ExcludeDomains: []string{"ads.example.test"}, ConvertLink: true})
+	cdn := "cdn.example.test:" + port
+	if len(files) != 2 || files[cdn+"/logo.png"] != "cdn.example.test" {
+		t.Fatalf("-D/--exclude-domains saved %v", files)
+	}
+	index := files["www.example.test:"+port+"/index.html"]
+	if !strings.Contains(index, `src="../`+cdn+`/logo.png"`) || !strings.Contains(index, `href="http://ads.example.test:`) {
+		t.Errorf("--convert-links did not rewrite only the spanned host's links: %s", index)
+	}
+}
+
+func TestMirrorAcceptRejectFilters(t *testing.T) {
+	pages := map[string]string{
+		"/index.html":            `<a href="/docs/v1/api/list.html">l</a><a href="/docs/v1/guide/g.pdf">g</a><a href="/img/a.png">i</a>`,
+		"/docs/v1/api/list.html": `<a href="ref.PDF">r</a><a href="ref.pdf?draft=1">d</a><a href="other.zip">z</a>`,
+		"/docs/v1/api/ref.PDF":   "ref",
+		"/docs/v1/api/ref.pdf":   "draft",
+		"/docs/v1/api/other.zip": "zip",
+		"/docs/v1/guide/g.pdf":   "guide",
+		"/img/a.png":             "png",
+	}
+	requested := make(map[string]bool)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".html") {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{
+		OutputDir:   t.TempDir(),
+		Mirror:      true,
+		Accept:      []string{"*.pdf"},
+		RejectRegex: regexp.MustCompile(`\?draft=`),
+		Include:     []string{"/DOCS/*/api"},
+		IgnoreCase:  true,
+	}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	if len(files) != 1 || files[u.Host+"/docs/v1/api/ref.PDF"] != "ref" {
+		t.Errorf("filters saved %v, want only docs/v1/api/ref.PDF", files)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range []string{"/docs/v1/api/list.html", "/docs/v1/api/ref.PDF"} {
+		if !requested[p] {
+			t.Errorf("%s was not fetched", p)
+		}
+	}
+	for _, p := range []string{"/docs/v1/guide/g.pdf", "/img/a.png", "/docs/v1/api/other.zip"} {
+		if requested[p] {
+			t.Errorf("%s was fetched although it is filtered out", p)
+		}
+	}
+}
+
+func TestMirrorNoParent(t *testing.T) {
+	pages := map[string]string{
+		"/docs/v2/":           `<a href="a.html">a</a><a href="/docs/v1/">v1</a><a href="/blog/post.html">b</a>`,
+		"/docs/v2":            `<a href="/docs/v2/a.html">a</a><a href="/docs/v1/">v1</a><a href="/docs/v2.1/">v2.1</a>`,
+		"/docs/v2.1/":         "v2.1",
+		"/docs/v2/a.html":     `<a href="../../index.html">home</a><a href="./">v2</a><a href="sub/b.html">b</a>`,
+		"/docs/v2/sub/b.html": "b",
+		"/docs/v1/":           "v1",
+		"/blog/post.html":     "post",
+		"/index.html":         "home",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	// /docs/v2 is saved as a directory, so it confines the crawl like /docs/v2/
+	for _, start := range []string{"/docs/v2/", "/docs/v2/a.html", "/docs/v2"} {
+		opts := Options{OutputDir: t.TempDir(), Mirror: true, NoParent: true}
+		if err := MirrorSite(srv.URL+start, opts, logger.NewLogger(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+		files := readTree(t, opts.OutputDir)
+		if len(files) != 3 || files[u.Host+"/docs/v2/sub/b.html"] != "b" {
+			t.Errorf("--no-parent from %s saved %d files, want the 3 under /docs/v2/", start, len(files))
+		}
+	}
+}
+
+func TestMirrorPageRequisites(t *testing.T) {
+	pages := map[string]string{
+		"/docs/index.html": `<a href="a.html">a</a>`,
+		"/docs/a.html": `<img srcset="/img/a.png 1x, /img/a@2x.png 2x"><script src="/js/app.js"></script>` +
+			`<link rel="icon" href="/favicon.ico"><link rel="next" href="/docs/b.html">` +
+			`<video poster="/v.jpg"><source src="/v.mp4"><track src="/t.vtt"></video><audio src="/a.mp3"></audio>` +
+			`<iframe src="/frame.html"></iframe><object data="/o.svg"></object><embed src="/e.svg">` +
+			`<input type="image" src="/btn.png"><meta property="og:image" content="/og.png"><a href="/blog.html">blog</a>`,
+		"/frame.html": `<img src="/f.png"><a href="/framed-link.html">x</a>`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if body, ok := pages[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, body)
+			return
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	requisites := []string{"/img/a.png", "/img/a@2x.png", "/js/app.js", "/favicon.ico", "/v.jpg", "/v.mp4",
+		"/t.vtt", "/a.mp3", "/frame.html", "/f.png", "/o.svg", "/e.svg", "/btn.png", "/og.png"}
+
+	// The requisites of a.html, one level down, are fetched despite -l 1 and --no-parent
+	opts := Options{OutputDir: t.TempDir(), Recursive: true, MaxDepth: 1, NoParent: true, PageRequisites: true, ConvertLink: true}
+	if err := MirrorSite(srv.URL+"/docs/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	for _, p := range requisites {
+		if _, ok := files[u.Host+p]; !ok {
+			t.Errorf("requisite %s was not saved", p)
+		}
+	}
+	for _, p := range []string{"/docs/b.html", "/blog.html", "/framed-link.html"} {
+		if _, ok := files[u.Host+p]; ok {
+			t.Errorf("%s is not a requisite but was saved", p)
+		}
+	}
+	if a := files[u.Host+"/docs/a.html"]; !strings.Contains(a, `srcset="../img/a.png 1x, ../img/a@2x.png 2x"`) {
+		t.Errorf("--convert-links did not rewrite srcset: %s", a)
+	}
+
+	// -p alone fetches one page and what it needs
+	opts = Options{OutputDir: t.TempDir(), PageRequisites: true}
+	if err := MirrorSite(srv.URL+"/docs/a.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if files := readTree(t, opts.OutputDir); len(files) != len(requisites)+1 {
+		t.Errorf("-p saved %d files, want the page and its %d requisites", len(files), len(requisites))
+	}
+}
+
+func TestMirrorFollowsStylesheets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<link rel="stylesheet" href="/css/site.css">`)
+		case "/css/site.css":
+			w.Header().Set("Content-Type", "text/css; charset=utf-8")
+			io.WriteString(w, `@import "theme.css"; body { background: url("/img/bg.png") }`)
+		case "/css/theme.css":
+			w.Header().Set("Content-Type", "text/css")
+			io.WriteString(w, `@font-face { src: url(../fonts/a.woff2) format("woff2") }`)
+		case "/img/bg.png", "/fonts/a.woff2":
+			io.WriteString(w, r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{OutputDir: t.TempDir(), Mirror: true, ConvertLink: true}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	for _, p := range []string{"/img/bg.png", "/fonts/a.woff2", "/css/theme.css"} {
+		if _, ok := files[u.Host+p]; !ok {
+			t.Errorf("%s referenced from a stylesheet was not saved", p)
+		}
+	}
+	if got := files[u.Host+"/css/site.css"]; got != `@import 'theme.css'; body { background: url('../img/bg.png') }` {
+		t.Errorf("--convert-links left site.css as %s", got)
+	}
+}
+
+func TestMirrorResolvesAgainstPageAndDedupesCanonical(t *testing.T) {
+	pages := map[string]string{
+		"/index.html":            `<a href="docs/guide/">guide</a><a href="/amp/post.html">post</a>`,
+		"/docs/guide/":           `<a href="intro.html">intro</a><meta http-equiv="refresh" content="10; url=../moved.html">`,
+		"/docs/guide/intro.html": `<base href="/media/"><img src="diagram.png">`,
+		"/docs/moved.html":       "moved",
+		"/media/diagram.png":     "png",
+		"/amp/post.html":         `<link rel="canonical" href="/post.html">amp`,
+		"/post.html":             `<link rel="canonical" href="/post.html">post`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{OutputDir: t.TempDir(), Mirror: true, Canonical: true}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	for _, p := range []string{"/docs/guide/intro.html", "/docs/moved.html", "/media/diagram.png", "/post.html"} {
+		if _, ok := files[u.Host+p]; !ok {
+			t.Errorf("%s was not saved", p)
+		}
+	}
+	if _, ok := files[u.Host+"/amp/post.html"]; ok || len(files) != 6 {
+		t.Errorf("--canonical saved %d files, want 6 without the AMP duplicate", len(files))
+	}
+}
+
+func TestMirrorPathsForQueriesAndDirectories(t *testing.T) {
+	pages := map[string]string{
+		"/index.html": `<a href="/page?id=1">1</a><a href="/page?id=2#top">2</a><a href="/blog">b</a>` +
+			`<a href="/blog/post">p</a><a href="/docs/v1.2">v</a><a href="/docs/v1.2/api.html">a</a>`,
+		"/page":               "page",
+		"/blog":               "blog",
+		"/blog/post":          "post",
+		"/docs/v1.2":          "docs",
+		"/docs/v1.2/api.html": "api",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/index.html" {
+			w.Header().Set("Content-Type", "text/html")
+		}
+		io.WriteString(w, body+r.URL.RawQuery)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{OutputDir: t.TempDir(), Mirror: true, ConvertLink: true}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	want := map[string]string{
+		"/page?id=1":            "pageid=1",
+		"/page?id=2":            "pageid=2",
+		"/blog/index.html":      "blog",
+		"/blog/post/index.html": "post",
+		"/docs/v1.2/index.html": "docs",
+		"/docs/v1.2/api.html":   "api",
+	}
+	for p, body := range want {
+		if files[u.Host+p] != body {
+			t.Errorf("%s holds %q, want %q", p, files[u.Host+p], body)
+		}
+	}
+	index := files[u.Host+"/index.html"]
+	for _, link := range []string{`href="page%3Fid=1"`, `href="page%3Fid=2#top"`, `href="blog/index.html"`, `href="docs/v1.2/index.html"`} {
+		if !strings.Contains(index, link) {
+			t.Errorf("converted index.html lacks %s: %s", link, index)
+		}
+	}
+}
+
+func TestMirrorAdjustExtension(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="/view.php?x=1">v</a><link rel="stylesheet" href="/theme?v=2"><a href="/about">a</a>`)
+		case "/view.php":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, `<a href="/index.html">home</a><a href="/about">about</a>`)
+		case "/theme":
+			w.Header().Set("Content-Type", "text/css")
+			io.WriteString(w, `body { background: url(/img.png) }`)
+		case "/about":
+			w.Header().Set("Content-Type", "text/html")
+			io.WriteString(w, `<a href="/view.php?x=1">v</a>`)
+		case "/img.png":
+			io.WriteString(w, "png")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{OutputDir: t.TempDir(), Mirror: true, AdjustExtension: true, ConvertLink: true, MirrorWorkers: 3}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	want := map[string][]string{
+		"/index.html":        {`href="view.php%3Fx=1.html"`, `href="theme%3Fv=2.css"`, `href="about/index.html"`},
+		"/view.php?x=1.html": {`href="index.html"`, `href="about/index.html"`},
+		"/about/index.html":  {`href="../view.php%3Fx=1.html"`},
+		"/theme?v=2.css":     {`url('img.png')`},
+	}
+	for p, links := range want {
+		body, ok := files[u.Host+p]
+		if !ok {
+			t.Errorf("%s was not saved", p)
+			continue
+		}
+		for _, link := range links {
+			if !strings.Contains(body, link) {
+				t.Errorf("%s lacks %s: %s", p, link, body)
+			}
+		}
+	}
+	if len(files) != 5 {
+		t.Errorf("saved %d files, want 5", len(files))
+	}
+}
+
+func TestMirrorRestrictFileNames(t *testing.T) {
+	long := strings.Repeat("x", 300) + ".html"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/index.html":
+			io.WriteString(w, `<a href="/Search?q=a:b">s</a><a href="/`+long+`">l</a>`)
+		case "/search", "/Search", "/" + long:
+			io.WriteString(w, `<a href="/index.html">home</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	opts := Options{
+		OutputDir:         t.TempDir(),
+		Mirror:            true,
+		ConvertLink:       true,
+		RestrictFileNames: util.FileNameRules{Windows: true, Lowercase: true},
+	}
+	if err := MirrorSite(srv.URL+"/index.html", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	files := readTree(t, opts.OutputDir)
+	host := strings.Replace(u.Host, ":", "+", 1)
+	index, ok := files[host+"/index.html"]
+	if !ok {
+		t.Fatalf("index.html not saved under %s", host)
+	}
+	if _, ok := files[host+"/search@q=a%3Ab"]; !ok {
+		t.Errorf("query page not saved as search@q=a%%3Ab")
+	}
+	if !strings.Contains(index, `href="search@q=a%253Ab"`) {
+		t.Errorf("link to query page not converted: %s", index)
+	}
+	for p := range files {
+		if name := filepath.Base(p); len(name) > 255 {
+			t.Errorf("saved %d-byte file name %s", len(name), name)
+		}
+	}
+	if len(files) != 3 {
+		t.Errorf("saved %d files, want 3", len(files))
+	}
+}
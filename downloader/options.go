@@ -1,15 +1,72 @@
 package downloader
 
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/jesee-kuya/wget/util"
+	"github.com/jesee-kuya/wget/warc"
+)
+
 // Options holds configuration flags passed to the downloader
 type Options struct {
-	OutputName  string   // -O: custom filename
-	OutputDir   string   // -P: directory to save file in
-	InputFile   string   // -i: input file with URLs
-	RateLimit   float64  // --rate-limit: in bytes per second
-	RunInBg     bool     // -B: download in background
-	LogFilePath string   // if -B is set, logs are redirected here
-	Reject      []string // -R: file suffixes to skip (e.g. []string{"jpg","gif"})
-	Exclude     []string // -X: directory paths to skip (e.g. []string{"/js","/assets"})
-	ConvertLink bool     // --convert-link: convert the links in the downloaded files so that they can be viewed offline
-	Mirror      bool     // --mirror: mirror the entire website starting from the given URL
+	OutputName        string             // -O: custom filename
+	OutputDir         string             // -P: directory to save file in
+	InputFile         string             // -i: input file with URLs
+	RateLimit         float64            // --rate-limit: in bytes per second
+	RunInBg           bool               // -B: download in background
+	LogFilePath       string             // if -B is set, logs are redirected here
+	Accept            []string           // -A: file suffixes or globs to keep, others are skipped (e.g. []string{"pdf","report-*.zip"})
+	Reject            []string           // -R: file suffixes or globs to skip (e.g. []string{"jpg","gif"})
+	AcceptRegex       *regexp.Regexp     // --accept-regex: only save URLs (query included) matching this
+	RejectRegex       *regexp.Regexp     // --reject-regex: never save URLs (query included) matching this
+	Include           []string           // -I: only crawl these directory paths or globs (e.g. []string{"/docs/*/api"})
+	Exclude           []string           // -X: directory paths or globs to skip (e.g. []string{"/js","/assets"})
+	IgnoreCase        bool               // --ignore-case: match -A/-R globs and -I/-X directories without regard to case
+	AdjustExtension   bool               // -E: add .html or .css to mirrored files whose Content-Type calls for it
+	RestrictFileNames util.FileNameRules // --restrict-file-names: characters to escape in saved file names (unix, windows, ascii, lowercase, nocontrol)
+	ConvertLink       bool               // --convert-link: convert the links in the downloaded files so that they can be viewed offline
+	Mirror            bool               // --mirror: mirror the entire website starting from the given URL
+	Recursive         bool               // -r: retrieve recursively like --mirror, limited to MaxDepth
+	MaxDepth          int                // -l: maximum link depth for -r and --mirror (0 = unlimited)
+	Canonical         bool               // --canonical: save a page only under its rel="canonical" URL
+	PageRequisites    bool               // -p: also fetch the images, scripts, stylesheets, media and frames pages need
+	NoParent          bool               // --no-parent: never follow links above the start URL's directory
+	SpanHosts         bool               // -H: follow links to other hosts
+	Domains           []string           // -D: hosts the crawl may visit besides the start host (suffixes or wildcards)
+	ExcludeDomains    []string           // --exclude-domains: hosts the crawl never visits
+	IgnoreRobots      bool               // -e robots=off: ignore robots.txt and nofollow hints while crawling
+	Sitemap           bool               // --sitemap: also crawl the pages listed in the start host's sitemaps
+	SitemapLastMod    bool               // --sitemap-lastmod: skip sitemap pages whose lastmod is older than the local copy
+	Quota             int64              // -Q: total bytes to retrieve across -i and --mirror runs (0 = unlimited)
+	MaxFileSize       int64              // --max-filesize: skip any single resource larger than this (0 = unlimited)
+	Inet4Only         bool               // -4: connect only to IPv4 addresses
+	Inet6Only         bool               // -6: connect only to IPv6 addresses
+	BindAddress       string             // --bind-address: local address to connect from
+	UnixSocket        string             // --unix-socket: dial every HTTP request over this Unix domain socket
+	Continue          bool               // -c: resume a partially downloaded file (HTTP Range, FTP REST)
+	FTPUser           string             // --ftp-user: FTP login when the URL carries none (default anonymous)
+	FTPPassword       string             // --ftp-password: password for FTPUser
+	NoPassiveFTP      bool               // --no-passive-ftp: use active mode (PORT/EPRT) for FTP data connections
+	SSHKey            string             // --ssh-key: private key for sftp:// (default ~/.ssh/id_ed25519, id_ecdsa, id_rsa)
+	KnownHosts        string             // --known-hosts: known_hosts file for sftp:// host key checks
+	S3Endpoint        string             // --s3-endpoint: S3-compatible service URL for s3:// (default AWS)
+	OutputSink        string             // --output-sink: directory, .tar/.tar.gz/.zip archive or s3://bucket/prefix to write to
+	WARCFile          string             // --warc-file: record HTTP exchanges to NAME.warc.gz with a NAME.cdx index
+	FromWARC          string             // --from-warc: answer HTTP requests from this WARC file instead of the network
+	Metalink          bool               // --metalink: the URL or file argument is a Metalink v4 document
+	MetalinkParallel  int                // --metalink-parallel: connections fetching verified pieces from several mirrors at once
+	PreferredLocation []string           // --preferred-location: country codes of mirrors to try first
+	MirrorWorkers     int                // --mirror-workers: URLs fetched concurrently by --mirror (0 or 1 = one at a time)
+	MirrorHostLimit   int                // --mirror-host-limit: concurrent --mirror requests per host (0 = no limit)
+
+	Resolve map[string]string // --resolve: "host:port" -> address overrides
+
+	quota  *quota       // shared byte counter for Quota, set up by DownloadInput and MirrorSite
+	client *http.Client // shared HTTP client, set up by DownloadInput and MirrorSite
+	replay *http.Client // answers web requests from FromWARC, set up by the top-level call
+	sink   Sink         // destination for OutputSink, set up by the top-level call
+	warc   *warc.Writer // archive for WARCFile, set up by the top-level call
+
+	noMetalink bool // set while fetching files described by a Metalink, so mirrors' documents are not followed
 }
@@ -0,0 +1,37 @@
+package downloader
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+var (
+	// ErrQuotaExceeded is returned when the -Q download quota has been used up.
+	ErrQuotaExceeded = errors.New("download quota exceeded")
+	// ErrFileTooLarge is returned when a resource is larger than --max-filesize.
+	ErrFileTooLarge = errors.New("file exceeds maximum file size")
+)
+
+// quota tracks the bytes retrieved against the -Q limit. A single quota is
+// shared by every download of a DownloadInput or MirrorSite run.
+type quota struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func newQuota(limit int64) *quota {
+	return &quota{limit: limit}
+}
+
+// Exceeded reports whether the quota has been used up. A nil quota or a zero
+// limit never runs out.
+func (q *quota) Exceeded() bool {
+	return q != nil && q.limit > 0 && q.used.Load() >= q.limit
+}
+
+// Add records n more retrieved bytes.
+func (q *quota) Add(n int64) {
+	if q != nil {
+		q.used.Add(n)
+	}
+}
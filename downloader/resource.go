@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Resource is an opened remote file, ready to be streamed to disk.
+type Resource struct {
+	Body        io.ReadCloser
+	Status      string // server reply shown to the user, e.g. "200 OK"
+	Size        int64  // bytes Body will yield, -1 if unknown
+	Offset      int64  // bytes already on disk that Body continues from
+	ContentType string
+}
+
+// Fetcher opens resources for a URL scheme. Fetch opens u for reading,
+// resuming after the first offset bytes when the protocol supports it; the
+// returned Offset is the offset actually honoured, which is 0 if the source
+// restarted from the beginning.
+type Fetcher interface {
+	Fetch(u *url.URL, offset int64, opts Options) (*Resource, error)
+}
+
+// FetcherFunc adapts an ordinary function to the Fetcher interface.
+type FetcherFunc func(u *url.URL, offset int64, opts Options) (*Resource, error)
+
+func (f FetcherFunc) Fetch(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	return f(u, offset, opts)
+}
+
+var (
+	fetchersMu sync.RWMutex
+	fetchers   = make(map[string]Fetcher)
+)
+
+func init() {
+	RegisterFetcher("http", FetcherFunc(openHTTP))
+	RegisterFetcher("https", FetcherFunc(openHTTP))
+	RegisterFetcher("ftp", ftpFetcher{})
+	RegisterFetcher("ftps", ftpFetcher{})
+	RegisterFetcher("sftp", sftpFetcher{})
+	RegisterFetcher("s3", s3Fetcher{})
+	RegisterFetcher("file", FetcherFunc(openFile))
+	RegisterFetcher("data", FetcherFunc(openData))
+}
+
+// RegisterFetcher makes f responsible for URLs with the given scheme,
+// replacing any fetcher previously registered for it.
+func RegisterFetcher(scheme string, f Fetcher) {
+	fetchersMu.Lock()
+	defer fetchersMu.Unlock()
+	fetchers[strings.ToLower(scheme)] = f
+}
+
+// fetcherFor returns the fetcher registered for scheme.
+func fetcherFor(scheme string) (Fetcher, bool) {
+	fetchersMu.RLock()
+	defer fetchersMu.RUnlock()
+	f, ok := fetchers[strings.ToLower(scheme)]
+	return f, ok
+}
+
+// openResource opens u with the fetcher registered for its scheme.
+func openResource(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	f, ok := fetcherFor(u.Scheme)
+	if !ok {
+		return nil, fmt.Errorf("unsupported URL scheme %q in %s", u.Scheme, u.Redacted())
+	}
+	return f.Fetch(u, offset, opts)
+}
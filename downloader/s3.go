@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/jesee-kuya/wget/s3"
+)
+
+// s3Fetcher retrieves s3://bucket/key URLs and lists s3://bucket/prefix/
+// for recursive retrieval.
+type s3Fetcher struct{}
+
+// s3Client builds a client from the environment/profile credentials and the
+// endpoint given by --s3-endpoint, AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL.
+// Requests go through the same HTTP client as every other download.
+func s3Client(opts Options) (*s3.Client, error) {
+	client, err := httpClient(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &s3.Client{Region: s3.LoadRegion(), Creds: s3.LoadCredentials(), HTTP: client}
+
+	endpoint := opts.S3Endpoint
+	for _, env := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint == "" {
+			endpoint = os.Getenv(env)
+		}
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		c.Endpoint = u
+	}
+
+	return c, nil
+}
+
+func (s3Fetcher) Fetch(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	bucket, key := u.Host, strings.TrimPrefix(u.Path, "/")
+	if key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("%s is a prefix, use --mirror to retrieve it", u)
+	}
+
+	c, err := s3Client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.GetObject(bucket, key, offset)
+	if err != nil {
+		return nil, err
+	}
+	return responseResource(resp, u, offset)
+}
+
+// List implements Lister with a delimited ListObjectsV2, so that common
+// prefixes appear as directories.
+func (s3Fetcher) List(u *url.URL, opts Options) ([]Entry, error) {
+	c, err := s3Client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	objects, prefixes, err := c.ListObjects(u.Host, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(objects)+len(prefixes))
+	for _, p := range prefixes {
+		entries = append(entries, Entry{URL: &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + p}, Dir: true, Size: -1})
+	}
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Key, "/") {
+			// Zero-byte "folder" marker objects
+			continue
+		}
+		entries = append(entries, Entry{URL: &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/" + obj.Key}, Size: obj.Size})
+	}
+	return entries, nil
+}
@@ -0,0 +1,296 @@
+package downloader
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/s3"
+	"github.com/jesee-kuya/wget/warc"
+)
+
+var testS3Creds = s3.Credentials{AccessKeyID: "minio", SecretAccessKey: "minio-secret"}
+
+// fakeS3 is a MinIO-style endpoint with path-style addressing that checks
+// every request's signature, stores uploaded objects and lists at most
+// pageSize entries at a time.
+type fakeS3 struct {
+	bucket   string
+	objects  map[string]string
+	pageSize int
+
+	mu     sync.Mutex
+	tokens []string // continuation tokens received
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		http.Error(w, "<Error><Code>SignatureDoesNotMatch</Code></Error>", http.StatusForbidden)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodPut {
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = string(body)
+		return
+	}
+	if r.URL.Query().Get("list-type") == "2" {
+		f.list(w, r.URL.Query())
+		return
+	}
+	body, ok := f.objects[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>")
+		return
+	}
+	http.ServeContent(w, r, key, time.Time{}, strings.NewReader(body))
+}
+
+// validSignature signs a copy of r with the headers it claims to have
+// signed and compares the result.
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	_, signed, ok := strings.Cut(auth, "SignedHeaders=")
+	if !ok {
+		return false
+	}
+	signed, _, _ = strings.Cut(signed, ",")
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	for _, name := range strings.Split(signed, ";") {
+		if name != "host" && name != "x-amz-date" && name != "x-amz-content-sha256" {
+			check.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	s3.Sign(check, testS3Creds, "us-east-1", r.Header.Get("X-Amz-Content-Sha256"), date)
+	return check.Header.Get("Authorization") == auth
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+
+	type entry struct {
+		key    string
+		prefix bool
+	}
+	seen := make(map[string]bool)
+	var entries []entry
+	for key := range f.objects {
+		rest, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		if i := strings.Index(rest, delimiter); delimiter != "" && i >= 0 {
+			p := prefix + rest[:i+len(delimiter)]
+			if !seen[p] {
+				seen[p] = true
+				entries = append(entries, entry{key: p, prefix: true})
+			}
+			continue
+		}
+		entries = append(entries, entry{key: key})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	start := 0
+	if token := q.Get("continuation-token"); token != "" {
+		f.tokens = append(f.tokens, token)
+		start, _ = strconv.Atoi(strings.TrimPrefix(token, "page-"))
+	}
+	end := min(start+f.pageSize, len(entries))
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	for _, e := range entries[start:end] {
+		var key strings.Builder
+		xml.EscapeText(&key, []byte(e.key))
+		if e.prefix {
+			fmt.Fprintf(&b, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", key.String())
+		} else {
+			fmt.Fprintf(&b, "<Contents><Key>%s</Key><Size>%d</Size></Contents>", key.String(), len(f.objects[e.key]))
+		}
+	}
+	if end < len(entries) {
+		fmt.Fprintf(&b, "<IsTruncated>true</IsTruncated><NextContinuationToken>page-%d</NextContinuationToken>", end)
+	} else {
+		b.WriteString("<IsTruncated>false</IsTruncated>")
+	}
+	b.WriteString("</ListBucketResult>")
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, b.String())
+}
+
+func startFakeS3(t *testing.T, objects map[string]string) (*fakeS3, Options) {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", testS3Creds.AccessKeyID)
+	t.Setenv("AWS_SECRET_ACCESS_KEY", testS3Creds.SecretAccessKey)
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	f := &fakeS3{bucket: "drops", objects: objects, pageSize: 2}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, Options{S3Endpoint: srv.URL}
+}
+
+func TestS3FetcherFetch(t *testing.T) {
+	_, opts := startFakeS3(t, map[string]string{
+		"reports/q1 summary.csv": "region,total\neu,42\n",
+	})
+
+	tests := []struct {
+		name       string
+		rawURL     string
+		offset     int64
+		wantBody   string
+		wantOffset int64
+	}{
+		{name: "whole object", rawURL: "s3://drops/reports/q1%20summary.csv", wantBody: "region,total\neu,42\n"},
+		{name: "resume", rawURL: "s3://drops/reports/q1%20summary.csv", offset: 13, wantBody: "eu,42\n", wantOffset: 13},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, _ := url.Parse(tt.rawURL)
+			res, err := s3Fetcher{}.Fetch(u, tt.offset, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.wantBody || res.Offset != tt.wantOffset {
+				t.Errorf("got %q at offset %d, want %q at offset %d", body, res.Offset, tt.wantBody, tt.wantOffset)
+			}
+		})
+	}
+
+	u, _ := url.Parse("s3://drops/reports/missing.csv")
+	var s3Err *s3.Error
+	if _, err := (s3Fetcher{}).Fetch(u, 0, opts); !errors.As(err, &s3Err) || s3Err.Code != "NoSuchKey" {
+		t.Errorf("fetching a missing key = %v, want a NoSuchKey error", err)
+	}
+	u, _ = url.Parse("s3://drops/reports/")
+	if _, err := (s3Fetcher{}).Fetch(u, 0, opts); err == nil {
+		t.Error("fetching a prefix succeeded")
+	}
+
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wrong")
+	u, _ = url.Parse("s3://drops/reports/q1%20summary.csv")
+	if _, err := (s3Fetcher{}).Fetch(u, 0, opts); !errors.As(err, &s3Err) || s3Err.StatusCode != http.StatusForbidden {
+		t.Errorf("fetching with a wrong secret = %v, want status 403", err)
+	}
+}
+
+func TestS3FetcherListPaginates(t *testing.T) {
+	f, opts := startFakeS3(t, map[string]string{
+		"logs/a.log":         "a",
+		"logs/b.log":         "bb",
+		"logs/c.log":         "ccc",
+		"logs/2024/":         "",
+		"logs/2024/jan.log":  "jan",
+		"logs/2025/feb.log":  "feb",
+		"logs/d.log":         "dddd",
+		"other/ignored.log":  "x",
+		"logs-old/stale.log": "x",
+	})
+
+	u, _ := url.Parse("s3://drops/logs")
+	entries, err := s3Fetcher{}.List(u, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		s := e.URL.String()
+		if e.Dir {
+			s += " dir"
+		} else {
+			s += fmt.Sprintf(" %d", e.Size)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"s3://drops/logs/2024/ dir",
+		"s3://drops/logs/2025/ dir",
+		"s3://drops/logs/a.log 1",
+		"s3://drops/logs/b.log 2",
+		"s3://drops/logs/c.log 3",
+		"s3://drops/logs/d.log 4",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("List =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Six entries at two per page take three requests
+	if strings.Join(f.tokens, " ") != "page-2 page-4" {
+		t.Errorf("continuation tokens sent = %v, want [page-2 page-4]", f.tokens)
+	}
+}
+
+func TestS3IgnoresWARCReplay(t *testing.T) {
+	f, opts := startFakeS3(t, map[string]string{"k.txt": "live"})
+
+	// An archive that records no S3 responses at all
+	name := filepath.Join(t.TempDir(), "empty")
+	w, err := warc.Create(name, "wget-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	opts.FromWARC = name + ".warc.gz"
+
+	opts.OutputDir = t.TempDir()
+	if err := DownloadFile("s3://drops/k.txt", opts, logger.NewLogger(io.Discard)); err != nil {
+		t.Fatalf("s3:// download with --from-warc: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(opts.OutputDir, "k.txt")); string(got) != "live" {
+		t.Errorf("downloaded %q, want the live object", got)
+	}
+
+	input := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(input, []byte("data:,uploaded\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sinkOpts := opts
+	sinkOpts.OutputDir = ""
+	sinkOpts.InputFile = input
+	sinkOpts.OutputSink = "s3://drops/out"
+	DownloadInput(sinkOpts, logger.NewLogger(io.Discard))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var uploaded []string
+	for key, body := range f.objects {
+		if strings.HasPrefix(key, "out/") && body == "uploaded" {
+			uploaded = append(uploaded, key)
+		}
+	}
+	if len(uploaded) != 1 {
+		t.Errorf("uploads to the S3 sink with --from-warc = %v, want one", uploaded)
+	}
+}
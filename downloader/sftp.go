@@ -0,0 +1,266 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/jesee-kuya/wget/util"
+)
+
+// defaultSSHKeys are tried, in order, when --ssh-key is not given.
+var defaultSSHKeys = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// sftpFetcher retrieves sftp:// URLs.
+type sftpFetcher struct{}
+
+// sftpSession bundles an SFTP client with the SSH connection it runs over
+// and the ssh-agent connection, if any, used to log in.
+type sftpSession struct {
+	*sftp.Client
+	ssh   *ssh.Client
+	agent net.Conn
+}
+
+func (s *sftpSession) Close() error {
+	s.Client.Close()
+	err := s.ssh.Close()
+	if s.agent != nil {
+		s.agent.Close()
+	}
+	return err
+}
+
+// sshAuthMethods collects agent, public key and URL password authentication.
+// The returned agent connection, nil without SSH_AUTH_SOCK, must be closed
+// by the caller once the SSH connection is done with it.
+func sshAuthMethods(u *url.URL, opts Options) ([]ssh.AuthMethod, net.Conn, error) {
+	var methods []ssh.AuthMethod
+
+	keys := defaultSSHKeys
+	if opts.SSHKey != "" {
+		keys = []string{opts.SSHKey}
+	}
+	var signers []ssh.Signer
+	for _, k := range keys {
+		keyPath, err := util.ExpandTilde(k)
+		if err != nil {
+			return nil, nil, err
+		}
+		pem, err := os.ReadFile(keyPath)
+		if err != nil {
+			if opts.SSHKey != "" {
+				return nil, nil, fmt.Errorf("reading SSH key: %w", err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			if opts.SSHKey != "" {
+				return nil, nil, fmt.Errorf("parsing SSH key %s: %w", keyPath, err)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+
+	if u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			methods = append(methods, ssh.Password(p))
+		}
+	}
+
+	// The agent is dialled last so that no error above leaves it open, but
+	// it is tried first
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			methods = append([]ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(conn).Signers)}, methods...)
+		}
+	}
+
+	if len(methods) == 0 {
+		return nil, nil, fmt.Errorf("no SSH credentials: start an ssh-agent or pass --ssh-key")
+	}
+	return methods, agentConn, nil
+}
+
+// sftpConnect opens an SFTP session for u, verifying the server's host key
+// against --known-hosts (default ~/.ssh/known_hosts).
+func sftpConnect(u *url.URL, opts Options) (*sftpSession, error) {
+	username := ""
+	if u.User != nil {
+		username = u.User.Username()
+	}
+	if username == "" {
+		if cur, err := user.Current(); err == nil {
+			username = cur.Username
+		}
+	}
+
+	knownHostsFile := opts.KnownHosts
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+	knownHostsFile, err := util.ExpandTilde(knownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading known hosts: %w", err)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	// --unix-socket only applies to HTTP
+	opts.UnixSocket = ""
+	d, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, agentConn, err := sshAuthMethods(u, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	closeAgent := func() {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+	}
+
+	config := &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		closeAgent()
+		return nil, err
+	}
+	client := ssh.NewClient(c, chans, reqs)
+
+	sc, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		closeAgent()
+		return nil, err
+	}
+	return &sftpSession{Client: sc, ssh: client, agent: agentConn}, nil
+}
+
+// sftpPath maps a URL path to a remote path. Like curl, a leading "/~/"
+// makes the path relative to the login directory.
+func sftpPath(u *url.URL) string {
+	if p, ok := strings.CutPrefix(u.Path, "/~/"); ok {
+		return path.Clean(p)
+	}
+	return path.Clean("/" + u.Path)
+}
+
+// Fetch opens the remote file, seeking to offset to resume.
+func (sftpFetcher) Fetch(u *url.URL, offset int64, opts Options) (*Resource, error) {
+	s, err := sftpConnect(u, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.Open(sftpPath(u))
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		s.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		s.Close()
+		return nil, fmt.Errorf("%s is a directory, use --mirror to retrieve it", sftpPath(u))
+	}
+
+	if offset > info.Size() {
+		offset = info.Size()
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		s.Close()
+		return nil, err
+	}
+
+	return &Resource{
+		Body:   &sftpBody{File: f, session: s},
+		Status: "opened remote file",
+		Size:   info.Size() - offset,
+		Offset: offset,
+	}, nil
+}
+
+// List implements Lister with a remote directory read.
+func (sftpFetcher) List(u *url.URL, opts Options) ([]Entry, error) {
+	s, err := sftpConnect(u, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	dir := sftpPath(u)
+	infos, err := s.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(infos))
+	for _, info := range infos {
+		child := *u
+		child.Path = path.Join(u.Path, info.Name())
+		entries = append(entries, Entry{URL: &child, Dir: info.IsDir(), Size: info.Size()})
+	}
+	return entries, nil
+}
+
+// sftpBody closes the SSH session along with the remote file.
+type sftpBody struct {
+	*sftp.File
+	session *sftpSession
+}
+
+func (b *sftpBody) Close() error {
+	err := b.File.Close()
+	b.session.Close()
+	return err
+}
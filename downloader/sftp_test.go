@@ -0,0 +1,243 @@
+package downloader
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/util"
+)
+
+// startSFTPServer runs an in-process SSH server with an SFTP subsystem that
+// only accepts clientKey. It returns the listen address and a known_hosts
+// file trusting the server.
+func startSFTPServer(t *testing.T, clientKey ssh.PublicKey) (string, string) {
+	t.Helper()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config)
+		}
+	}()
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHosts, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return ln.Addr().String(), knownHosts
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server, err := sftp.NewServer(ch)
+					if err == nil {
+						server.Serve()
+					}
+					ch.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTPDownloadResumeAndMirror(t *testing.T) {
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, knownHosts := startSFTPServer(t, sshPub)
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	remote := t.TempDir()
+	content := "vendor drop contents\n"
+	if err := os.MkdirAll(filepath.Join(remote, "drops", "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(remote, "drops", "report.csv"), []byte(content), 0o644)
+	os.WriteFile(filepath.Join(remote, "drops", "nested", "data.bin"), []byte("nested"), 0o644)
+
+	log := logger.NewLogger(io.Discard)
+	out := t.TempDir()
+	opts := Options{OutputDir: out, SSHKey: keyFile, KnownHosts: knownHosts}
+
+	// Resume from a partial local copy
+	if err := os.WriteFile(filepath.Join(out, "report.csv"), []byte(content[:7]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resumeOpts := opts
+	resumeOpts.Continue = true
+	fileURL := "sftp://tester@" + addr + filepath.ToSlash(filepath.Join(remote, "drops", "report.csv"))
+	if err := DownloadFile(fileURL, resumeOpts, log); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(out, "report.csv")); string(got) != content {
+		t.Errorf("resumed download = %q, want %q", got, content)
+	}
+
+	// Recursive retrieval of the whole directory
+	dirURL := "sftp://tester@" + addr + filepath.ToSlash(filepath.Join(remote, "drops"))
+	if err := MirrorSite(dirURL, opts, log); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(out, addr, remote, "drops", "nested", "data.bin")
+	if got, err := os.ReadFile(nested); err != nil || string(got) != "nested" {
+		t.Errorf("mirrored %s = %q, %v", nested, got, err)
+	}
+
+	// Windows rules lay the tree out like an HTTP mirror of the same host
+	winOpts := opts
+	winOpts.OutputDir = t.TempDir()
+	winOpts.RestrictFileNames = util.FileNameRules{Windows: true}
+	if err := MirrorSite(dirURL, winOpts, log); err != nil {
+		t.Fatal(err)
+	}
+	hostDir, _ := util.URLPath("http://"+addr+"/", winOpts.RestrictFileNames)
+	nested = filepath.Join(winOpts.OutputDir, filepath.Dir(hostDir), remote, "drops", "nested", "data.bin")
+	if _, err := os.Stat(nested); err != nil {
+		t.Errorf("windows rules: %v", err)
+	}
+
+	// An unknown host key must be rejected
+	badOpts := opts
+	badOpts.KnownHosts = filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(badOpts.KnownHosts, nil, 0o600)
+	if err := DownloadFile(fileURL, badOpts, log); err == nil {
+		t.Error("expected download from an unknown host to fail")
+	}
+}
+
+func TestSFTPClosesAgentConnection(t *testing.T) {
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: clientPriv}); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, knownHosts := startSFTPServer(t, signer.PublicKey())
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+	var open atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			open.Add(1)
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+				open.Add(-1)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	remote := t.TempDir()
+	os.WriteFile(filepath.Join(remote, "a.txt"), []byte("a"), 0o644)
+	fileURL := "sftp://tester@" + addr + filepath.ToSlash(filepath.Join(remote, "a.txt"))
+	// No default key exists in an empty home, so only the agent can log in
+	t.Setenv("HOME", t.TempDir())
+	opts := Options{OutputDir: t.TempDir(), KnownHosts: knownHosts}
+	for range 3 {
+		if err := DownloadFile(fileURL, opts, logger.NewLogger(io.Discard)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for open.Load() != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := open.Load(); n != 0 {
+		t.Errorf("%d agent connections left open", n)
+	}
+}
@@ -0,0 +1,291 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jesee-kuya/wget/s3"
+)
+
+// Sink is where downloaded files are written. Names are the output paths the
+// local layout would use (e.g. "www.example.com/css/site.css").
+type Sink interface {
+	// Create starts a new file called name.
+	Create(name string) (SinkFile, error)
+	// Location describes where name ends up, for logging.
+	Location(name string) string
+	// Close finishes the sink, e.g. by writing an archive's trailer.
+	Close() error
+}
+
+// SinkFile is a file being written to a Sink. Close commits it; Discard
+// drops it after a failed download.
+type SinkFile interface {
+	io.Writer
+	Close() error
+	Discard()
+}
+
+// newSink selects the sink for --output-sink: an s3://bucket/prefix URL, a
+// .tar, .tar.gz, .tgz or .zip archive, or otherwise a local directory.
+func newSink(spec string, opts Options) (Sink, error) {
+	lower := strings.ToLower(spec)
+	switch {
+	case strings.HasPrefix(lower, "s3://"):
+		return newS3Sink(spec, opts)
+	case strings.HasSuffix(lower, ".tar"):
+		return newArchiveSink(spec, "tar")
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return newArchiveSink(spec, "tar.gz")
+	case strings.HasSuffix(lower, ".zip"):
+		return newArchiveSink(spec, "zip")
+	default:
+		return &dirSink{root: spec}, nil
+	}
+}
+
+// openSink sets up opts.sink for a top-level run. The returned function
+// closes the sink if this call created it.
+func openSink(opts *Options) (func() error, error) {
+	if opts.sink != nil {
+		return func() error { return nil }, nil
+	}
+	if opts.OutputSink == "" {
+		opts.sink = &dirSink{}
+		return func() error { return nil }, nil
+	}
+
+	sink, err := newSink(opts.OutputSink, *opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.sink = sink
+	return sink.Close, nil
+}
+
+// writeSinkFile stores data as name in sink.
+func writeSinkFile(sink Sink, name string, data []byte) error {
+	f, err := sink.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Discard()
+		return err
+	}
+	return f.Close()
+}
+
+// sinkName turns an output path into a relative, slash-separated name that
+// cannot climb out of an archive or bucket prefix.
+func sinkName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+// dirSink writes files to the local filesystem, which is the default.
+// DownloadFile recognises it to offer resume, free-space checks and
+// preallocation, which only make sense on local files.
+type dirSink struct {
+	root string
+}
+
+func (d *dirSink) path(name string) string {
+	return filepath.Join(d.root, name)
+}
+
+func (d *dirSink) Create(name string) (SinkFile, error) {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{File: f}, nil
+}
+
+func (d *dirSink) Location(name string) string {
+	return d.path(name)
+}
+
+func (d *dirSink) Close() error {
+	return nil
+}
+
+// localFile is a SinkFile written in place.
+type localFile struct {
+	*os.File
+}
+
+func (f *localFile) Discard() {
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// spoolFile buffers an entry in a temporary file until it is committed,
+// so that concurrent downloads can share one archive or know their size
+// before uploading.
+type spoolFile struct {
+	*os.File
+	name   string
+	commit func(name string, f *os.File, size int64) error
+}
+
+func newSpoolFile(name string, commit func(string, *os.File, int64) error) (*spoolFile, error) {
+	f, err := os.CreateTemp("", "wget-spool-*")
+	if err != nil {
+		return nil, err
+	}
+	return &spoolFile{File: f, name: name, commit: commit}, nil
+}
+
+func (s *spoolFile) Close() error {
+	defer os.Remove(s.File.Name())
+	defer s.File.Close()
+
+	size, err := s.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.File.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return s.commit(s.name, s.File, size)
+}
+
+func (s *spoolFile) Discard() {
+	s.File.Close()
+	os.Remove(s.File.Name())
+}
+
+// archiveSink writes every file into a single tar, tar.gz or zip archive.
+type archiveSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	tw   *tar.Writer
+	zw   *zip.Writer
+}
+
+func newArchiveSink(p, format string) (*archiveSink, error) {
+	f, err := os.Create(p)
+	if err != nil {
+		return nil, fmt.Errorf("creating archive: %w", err)
+	}
+
+	a := &archiveSink{path: p, file: f}
+	switch format {
+	case "tar":
+		a.tw = tar.NewWriter(f)
+	case "tar.gz":
+		a.gz = gzip.NewWriter(f)
+		a.tw = tar.NewWriter(a.gz)
+	case "zip":
+		a.zw = zip.NewWriter(f)
+	}
+	return a, nil
+}
+
+func (a *archiveSink) Create(name string) (SinkFile, error) {
+	return newSpoolFile(sinkName(name), a.add)
+}
+
+// add appends one spooled file to the archive.
+func (a *archiveSink) add(name string, f *os.File, size int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var w io.Writer
+	if a.tw != nil {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+		if err := a.tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		w = a.tw
+	} else {
+		zf, err := a.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		w = zf
+	}
+
+	_, err := io.Copy(w, f)
+	return err
+}
+
+func (a *archiveSink) Location(name string) string {
+	return a.path + ":" + sinkName(name)
+}
+
+func (a *archiveSink) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var err error
+	if a.tw != nil {
+		err = a.tw.Close()
+	}
+	if a.gz != nil {
+		if gzErr := a.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if a.zw != nil {
+		err = a.zw.Close()
+	}
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// s3Sink uploads every file as an object under a bucket prefix.
+type s3Sink struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Sink(spec string, opts Options) (*s3Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 output sink %q, expected s3://bucket/prefix", spec)
+	}
+
+	client, err := s3Client(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Sink{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+}
+
+func (s *s3Sink) key(name string) string {
+	return path.Join(s.prefix, sinkName(name))
+}
+
+func (s *s3Sink) Create(name string) (SinkFile, error) {
+	return newSpoolFile(s.key(name), func(key string, f *os.File, size int64) error {
+		return s.client.PutObject(s.bucket, key, f, size)
+	})
+}
+
+func (s *s3Sink) Location(name string) string {
+	return "s3://" + s.bucket + "/" + s.key(name)
+}
+
+func (s *s3Sink) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+package downloader
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveSink(t *testing.T) {
+	files := map[string]string{
+		"example.com/index.html":    "<html></html>",
+		"example.com/css/site.css":  "body{}",
+		"/abs/../../escape/x.txt":   "contained",
+		"example.com/discarded.bin": "",
+	}
+
+	for _, name := range []string{"out.tar.gz", "out.zip"} {
+		archive := filepath.Join(t.TempDir(), name)
+		sink, err := newSink(archive, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for file, content := range files {
+			f, err := sink.Create(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(f, content)
+			if content == "" {
+				f.Discard()
+				continue
+			}
+			if err := f.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		got := readArchive(t, archive)
+		want := map[string]string{
+			"example.com/index.html":   "<html></html>",
+			"example.com/css/site.css": "body{}",
+			"escape/x.txt":             "contained",
+		}
+		if len(got) != len(want) {
+			t.Errorf("%s: got entries %v, want %v", name, got, want)
+		}
+		for k, v := range want {
+			if got[k] != v {
+				t.Errorf("%s: entry %s = %q, want %q", name, k, got[k], v)
+			}
+		}
+	}
+}
+
+func readArchive(t *testing.T, archive string) map[string]string {
+	t.Helper()
+	entries := make(map[string]string)
+
+	if filepath.Ext(archive) == ".zip" {
+		zr, err := zip.OpenReader(archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			rc, _ := f.Open()
+			b, _ := io.ReadAll(rc)
+			rc.Close()
+			entries[f.Name] = string(b)
+		}
+		return entries
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(tr)
+		entries[hdr.Name] = string(b)
+	}
+}
@@ -0,0 +1,109 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/jesee-kuya/wget/parser"
+)
+
+// maxSitemapDepth bounds how many levels of sitemap indexes are followed.
+const maxSitemapDepth = 5
+
+// maxSitemapFetch is the largest sitemap, compressed or not, that is read.
+const maxSitemapFetch = 50 << 20
+
+// seedFromSitemaps queues the pages listed in the sitemaps of the start
+// host: those named by Sitemap: lines in its robots.txt, or /sitemap.xml
+// when there are none. Sitemap indexes are followed, including gzipped
+// sitemaps. With --sitemap-lastmod, pages whose <lastmod> is no newer than
+// the copy already on disk are not fetched again. Listed pages on hosts the
+// crawl does not span, or above the start directory with --no-parent, are
+// ignored.
+func (c *crawler) seedFromSitemaps() {
+	rules := c.robotsFor(c.base)
+	if rules == nil {
+		// -e robots=off still reads the Sitemap: lines
+		rules = fetchRobots(c.base, c.opts)
+	}
+	locations := rules.Sitemaps
+	if len(locations) == 0 {
+		locations = []string{(&url.URL{Scheme: c.base.Scheme, Host: c.base.Host, Path: "/sitemap.xml"}).String()}
+	}
+
+	seen := make(map[string]bool)
+	var walk func(loc string, level int)
+	walk = func(loc string, level int) {
+		if seen[loc] || level > maxSitemapDepth {
+			return
+		}
+		seen[loc] = true
+
+		resp, data, err := fetchBytes(loc, maxSitemapFetch, c.opts)
+		if err != nil {
+			c.log.Error(fmt.Errorf("failed to fetch sitemap %s: %w", loc, err))
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			c.log.Error(fmt.Errorf("bad status for sitemap %s: %s", loc, resp.Status))
+			return
+		}
+		sm, err := parser.ParseSitemap(bytes.NewReader(data))
+		if err != nil {
+			c.log.Error(fmt.Errorf("%s: %w", loc, err))
+			return
+		}
+
+		for _, e := range sm.Sitemaps {
+			walk(e.Loc, level+1)
+		}
+		for _, e := range sm.URLs {
+			u, err := url.Parse(e.Loc)
+			if err != nil || !c.spans(u) || !c.belowStart(u) {
+				continue
+			}
+			if c.opts.SitemapLastMod && c.upToDate(e) {
+				c.markDone(e.Loc)
+				c.log.Skipped(e.Loc, "not modified since the local copy (sitemap lastmod)")
+				continue
+			}
+			c.enqueue([]string{e.Loc}, 0)
+		}
+	}
+
+	for _, loc := range locations {
+		walk(loc, 0)
+	}
+}
+
+// upToDate reports whether the local copy of a sitemap entry is at least as
+// recent as its <lastmod>. Only local output can be checked.
+func (c *crawler) upToDate(e parser.SitemapEntry) bool {
+	local, ok := c.opts.sink.(*dirSink)
+	if !ok || e.LastMod.IsZero() {
+		return false
+	}
+	p, err := mirrorPath(e.Loc, c.opts)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(local.path(p))
+	if err != nil && c.opts.AdjustExtension {
+		// A page saved by an earlier -E run
+		info, err = os.Stat(local.path(p + ".html"))
+	}
+	return err == nil && !info.ModTime().Before(e.LastMod)
+}
+
+// markDone records rawURL as handled without fetching it, so links to it
+// are not followed either.
+func (c *crawler) markDone(rawURL string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.queued[rawURL]; !ok {
+		c.queued[rawURL] = &crawlTask{url: rawURL}
+	}
+}
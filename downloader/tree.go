@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/jesee-kuya/wget/logger"
+	"github.com/jesee-kuya/wget/util"
+)
+
+// Entry is one item of a directory listing.
+type Entry struct {
+	URL  *url.URL
+	Dir  bool
+	Size int64 // -1 if unknown
+}
+
+// Lister is implemented by fetchers whose scheme has a notion of directories,
+// letting MirrorSite retrieve a whole tree instead of crawling HTML links.
+type Lister interface {
+	// List returns the entries directly inside the directory u.
+	List(u *url.URL, opts Options) ([]Entry, error)
+}
+
+// mirrorTree recursively retrieves the directory tree rooted at base through
+// l, saving it under <OutputDir>/<host>/ the same way MirrorSite lays out
+// HTTP sites. Files are fetched with DownloadFile. Each directory level
+// counts as one level of -l: files directly in base are at depth 1.
+func mirrorTree(base *url.URL, l Lister, opts Options, log *logger.Logger) error {
+	type dirTask struct {
+		url   *url.URL
+		depth int
+	}
+	queue := []dirTask{{base, 0}}
+	for len(queue) > 0 {
+		dir, depth := queue[0].url, queue[0].depth
+		queue = queue[1:]
+
+		entries, err := l.List(dir, opts)
+		if err != nil {
+			if dir == base {
+				return fmt.Errorf("failed to list %s: %w", dir.Redacted(), err)
+			}
+			log.Error(fmt.Errorf("failed to list %s: %w", dir.Redacted(), err))
+			continue
+		}
+
+		for _, e := range entries {
+			if e.Dir {
+				// Files inside the subdirectory would be two levels down
+				if opts.MaxDepth > 0 && depth+2 > opts.MaxDepth {
+					continue
+				}
+				// -I is checked against files, since a directory outside it may lead into it
+				if !util.MatchDir(e.URL.Path, opts.Exclude, opts.IgnoreCase) {
+					queue = append(queue, dirTask{e.URL, depth + 1})
+				}
+				continue
+			}
+
+			if !fileAccepted(e.URL, opts) || !dirAllowed(e.URL, opts) {
+				continue
+			}
+
+			fileURL := e.URL.String()
+			if opts.quota.Exceeded() {
+				log.Skipped(fileURL, ErrQuotaExceeded.Error())
+				return nil
+			}
+
+			if opts.MaxFileSize > 0 && e.Size > opts.MaxFileSize {
+				log.Skipped(fileURL, fmt.Sprintf("size %s exceeds --max-filesize %s",
+					util.ContentSize(e.Size), util.ContentSize(opts.MaxFileSize)))
+				continue
+			}
+
+			// The listing tells files from directories, so the layout is built
+			// here rather than guessed by util.URLPath.
+			rules := opts.RestrictFileNames
+			rel := path.Clean("/" + e.URL.Path)
+			saveDir, err := util.JoinWithin(opts.OutputDir, rules.Host(base.Host)+rules.Path(path.Dir(rel)))
+			if err != nil {
+				log.Error(err)
+				continue
+			}
+
+			fileOpts := opts
+			fileOpts.OutputDir = saveDir
+			fileOpts.OutputName = rules.Name(path.Base(rel))
+			// Errors are already logged by DownloadFile
+			DownloadFile(fileURL, fileOpts, log)
+		}
+	}
+
+	return nil
+}
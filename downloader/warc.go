@@ -0,0 +1,114 @@
+package downloader
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+
+	"github.com/jesee-kuya/wget/warc"
+)
+
+// warcSoftware identifies this tool in the warcinfo record.
+const warcSoftware = "wget (github.com/jesee-kuya/wget)"
+
+// openWARC sets up opts.warc for --warc-file in a top-level run. The returned
+// function closes the archive if this call created it.
+func openWARC(opts *Options) (func() error, error) {
+	if opts.warc != nil || opts.WARCFile == "" {
+		return func() error { return nil }, nil
+	}
+
+	w, err := warc.Create(opts.WARCFile, warcSoftware)
+	if err != nil {
+		return nil, err
+	}
+	opts.warc = w
+	return w.Close, nil
+}
+
+// openReplay sets up opts.replay to answer requests for web pages and
+// files from the archive named by --from-warc. S3 requests, including
+// uploads to an S3 output sink, still use the network. The returned
+// function releases the archive if this call opened it.
+func openReplay(opts *Options) (func() error, error) {
+	if opts.replay != nil || opts.FromWARC == "" {
+		return func() error { return nil }, nil
+	}
+
+	a, err := warc.Open(opts.FromWARC)
+	if err != nil {
+		return nil, err
+	}
+	opts.replay = &http.Client{Transport: a}
+	return a.Close, nil
+}
+
+// traceRemoteIP arranges for the address of the server that answers req to
+// be recorded. The returned function reports it once the response arrived.
+func traceRemoteIP(req *http.Request) (*http.Request, func() string) {
+	var ip string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				ip = host
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return req, func() string { return ip }
+}
+
+// warcBody spools a response body while it is streamed and writes the whole
+// exchange to the WARC file on Close, provided the body was read to the end.
+// Truncated transfers are not archived.
+type warcBody struct {
+	io.ReadCloser
+	resp     *http.Response
+	remoteIP func() string
+	w        *warc.Writer
+	spool    *os.File
+	complete bool
+	closed   bool
+}
+
+func newWARCBody(resp *http.Response, remoteIP func() string, w *warc.Writer) (*warcBody, error) {
+	spool, err := os.CreateTemp("", "wget-warc-*")
+	if err != nil {
+		return nil, err
+	}
+	return &warcBody{ReadCloser: resp.Body, resp: resp, remoteIP: remoteIP, w: w, spool: spool}, nil
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if _, werr := b.spool.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+func (b *warcBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	defer os.Remove(b.spool.Name())
+	defer b.spool.Close()
+
+	err := b.ReadCloser.Close()
+	if !b.complete {
+		return err
+	}
+	if _, serr := b.spool.Seek(0, io.SeekStart); serr != nil {
+		return errors.Join(err, serr)
+	}
+	return errors.Join(err, b.w.WriteExchange(b.resp.Request, b.resp, b.remoteIP(), b.spool))
+}
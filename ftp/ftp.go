@@ -0,0 +1,317 @@
+// Package ftp implements the subset of the FTP protocol (RFC 959) needed to
+// retrieve files and directory listings, including explicit FTPS (RFC 4217).
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config controls how a connection is established.
+type Config struct {
+	// Dial opens the control and passive data connections. A nil Dial uses net.Dialer.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+	// TLS enables explicit FTPS: the session is upgraded with AUTH TLS and
+	// data connections are protected with PROT P.
+	TLS *tls.Config
+	// Active makes the server connect back to us (PORT/EPRT) instead of
+	// using passive mode (EPSV/PASV).
+	Active bool
+	// Timeout bounds dialing and waiting for active data connections.
+	Timeout time.Duration
+}
+
+// Conn is a logged-in FTP control connection.
+type Conn struct {
+	cfg  Config
+	conn net.Conn
+	text *textproto.Conn
+}
+
+// Dial connects to the FTP server at addr (host:port) and reads its greeting.
+// When cfg.TLS is set the control connection is upgraded before returning.
+func Dial(addr string, cfg Config) (*Conn, error) {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Dial == nil {
+		d := &net.Dialer{Timeout: cfg.Timeout}
+		cfg.Dial = d.DialContext
+	}
+
+	conn, err := dial(cfg, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{cfg: cfg, conn: conn, text: textproto.NewConn(conn)}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("ftp greeting: %w", err)
+	}
+
+	if cfg.TLS != nil {
+		if _, _, err := c.cmd(2, "AUTH TLS"); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ftp AUTH TLS: %w", err)
+		}
+		tlsConn := tls.Client(conn, cfg.TLS)
+		if err := tlsConn.Handshake(); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("ftp TLS handshake: %w", err)
+		}
+		c.conn = tlsConn
+		c.text = textproto.NewConn(tlsConn)
+	}
+
+	return c, nil
+}
+
+func dial(cfg Config, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+	defer cancel()
+	return cfg.Dial(ctx, "tcp", addr)
+}
+
+// cmd sends a command and reads the reply, checking it against expect as
+// textproto.Reader.ReadResponse does (e.g. 2 accepts any 2xx reply).
+func (c *Conn) cmd(expect int, format string, args ...any) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+// Login authenticates and switches to binary transfer mode. On an FTPS
+// session it also enables protection of data connections.
+func (c *Conn) Login(user, password string) error {
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return err
+	}
+	switch code {
+	case 230:
+	case 331, 332:
+		if _, _, err := c.cmd(2, "PASS %s", password); err != nil {
+			return fmt.Errorf("ftp login as %s: %w", user, err)
+		}
+	default:
+		return fmt.Errorf("ftp login as %s: %w", user, &textproto.Error{Code: code, Msg: msg})
+	}
+
+	if c.cfg.TLS != nil {
+		if _, _, err := c.cmd(2, "PBSZ 0"); err != nil {
+			return fmt.Errorf("ftp PBSZ: %w", err)
+		}
+		if _, _, err := c.cmd(2, "PROT P"); err != nil {
+			return fmt.Errorf("ftp PROT: %w", err)
+		}
+	}
+
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return fmt.Errorf("ftp TYPE I: %w", err)
+	}
+	return nil
+}
+
+// Size returns the size of the file at path, as reported by the SIZE command.
+func (c *Conn) Size(path string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", path)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+// Retr starts retrieving the file at path, skipping the first offset bytes
+// with REST. The transfer completes when the returned reader is closed.
+func (c *Conn) Retr(path string, offset int64) (io.ReadCloser, error) {
+	return c.transfer(offset, "RETR %s", path)
+}
+
+// List returns the entries of the directory at path.
+func (c *Conn) List(path string) ([]Entry, error) {
+	r, err := c.transfer(0, "LIST %s", path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, readErr := io.ReadAll(r)
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	var entries []Entry
+	for _, line := range strings.Split(string(data), "\n") {
+		if e, ok := ParseListLine(strings.TrimRight(line, "\r")); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// Quit ends the session and closes the connection.
+func (c *Conn) Quit() error {
+	c.cmd(2, "QUIT")
+	return c.Close()
+}
+
+// Close closes the control connection without saying goodbye.
+func (c *Conn) Close() error {
+	return c.text.Close()
+}
+
+// transfer sets up a data connection and issues a command that uses it.
+func (c *Conn) transfer(offset int64, format string, args ...any) (io.ReadCloser, error) {
+	var (
+		data net.Conn
+		ln   net.Listener
+		err  error
+	)
+	if c.cfg.Active {
+		ln, err = c.listenActive()
+	} else {
+		data, err = c.dialPassive()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cleanup := func() {
+		if data != nil {
+			data.Close()
+		}
+		if ln != nil {
+			ln.Close()
+		}
+	}
+
+	if offset > 0 {
+		if _, _, err := c.cmd(3, "REST %d", offset); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("ftp REST: %w", err)
+		}
+	}
+
+	if _, _, err := c.cmd(1, format, args...); err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	if ln != nil {
+		if tl, ok := ln.(*net.TCPListener); ok {
+			tl.SetDeadline(time.Now().Add(c.cfg.Timeout))
+		}
+		data, err = ln.Accept()
+		ln.Close()
+		if err != nil {
+			return nil, fmt.Errorf("ftp active data connection: %w", err)
+		}
+	}
+
+	if c.cfg.TLS != nil {
+		data = tls.Client(data, c.cfg.TLS)
+	}
+
+	return &dataReader{Conn: data, c: c}, nil
+}
+
+// dialPassive asks for a passive data port, trying EPSV before PASV. The
+// data connection always goes to the control connection's host so that
+// servers behind NAT advertising a private address still work.
+func (c *Conn) dialPassive() (net.Conn, error) {
+	host, _, err := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := c.epsv()
+	if err != nil {
+		port, err = c.pasv()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return dial(c.cfg, net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// epsv parses a reply like "229 Entering Extended Passive Mode (|||6446|)".
+func (c *Conn) epsv() (int, error) {
+	_, msg, err := c.cmd(229, "EPSV")
+	if err != nil {
+		return 0, err
+	}
+	start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+	if start < 0 || end < start+4 {
+		return 0, fmt.Errorf("ftp: malformed EPSV reply %q", msg)
+	}
+	return strconv.Atoi(msg[start+4 : end])
+}
+
+// pasv parses a reply like "227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)".
+func (c *Conn) pasv() (int, error) {
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return 0, err
+	}
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if start < 0 || end < start {
+		return 0, fmt.Errorf("ftp: malformed PASV reply %q", msg)
+	}
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("ftp: malformed PASV reply %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("ftp: malformed PASV reply %q", msg)
+	}
+	return p1<<8 | p2, nil
+}
+
+// listenActive opens a local port on the control connection's interface and
+// tells the server about it with PORT (IPv4) or EPRT (IPv6).
+func (c *Conn) listenActive() (net.Listener, error) {
+	local := c.conn.LocalAddr().(*net.TCPAddr)
+	ln, err := net.Listen("tcp", net.JoinHostPort(local.IP.String(), "0"))
+	if err != nil {
+		return nil, err
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	if ip4 := local.IP.To4(); ip4 != nil {
+		_, _, err = c.cmd(2, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(2, "EPRT |2|%s|%d|", local.IP, port)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("ftp active mode: %w", err)
+	}
+	return ln, nil
+}
+
+// dataReader is a data connection whose Close waits for the server to
+// confirm that the transfer finished.
+type dataReader struct {
+	net.Conn
+	c *Conn
+}
+
+func (d *dataReader) Close() error {
+	d.Conn.Close()
+	_, _, err := d.c.text.ReadResponse(2)
+	return err
+}
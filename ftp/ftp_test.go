@@ -0,0 +1,223 @@
+package ftp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testServer is a minimal in-process FTP server serving files from memory.
+type testServer struct {
+	ln    net.Listener
+	files map[string]string
+	dirs  map[string]string // path -> raw LIST output
+}
+
+func newTestServer(t *testing.T) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{
+		ln:    ln,
+		files: map[string]string{"pub/hello.txt": "hello, ftp world\n"},
+		dirs: map[string]string{
+			"pub": "total 2\r\n" +
+				"drwxr-xr-x   2 ftp  ftp      4096 Jan 02 10:00 docs\r\n" +
+				"-rw-r--r--   1 ftp  ftp        17 Jan 02 10:00 hello.txt\r\n",
+		},
+	}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *testServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *testServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...any) { fmt.Fprintf(conn, format+"\r\n", args...) }
+
+	var (
+		pasv   net.Listener
+		active string
+		rest   int64
+	)
+	openData := func() (net.Conn, error) {
+		if active != "" {
+			return net.Dial("tcp", active)
+		}
+		defer pasv.Close()
+		return pasv.Accept()
+	}
+
+	reply("220 test server ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			if arg != "secret" {
+				reply("530 login incorrect")
+				continue
+			}
+			reply("230 logged in")
+		case "TYPE":
+			reply("200 type set")
+		case "EPSV":
+			pasv, _ = net.Listen("tcp", "127.0.0.1:0")
+			active = ""
+			reply("229 Entering Extended Passive Mode (|||%d|)", pasv.Addr().(*net.TCPAddr).Port)
+		case "PORT":
+			f := strings.Split(arg, ",")
+			p1, _ := strconv.Atoi(f[4])
+			p2, _ := strconv.Atoi(f[5])
+			active = fmt.Sprintf("%s.%s.%s.%s:%d", f[0], f[1], f[2], f[3], p1<<8|p2)
+			reply("200 PORT ok")
+		case "SIZE":
+			body, ok := s.files[arg]
+			if !ok {
+				reply("550 no such file")
+				continue
+			}
+			reply("213 %d", len(body))
+		case "REST":
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			reply("350 restarting at %d", rest)
+		case "RETR", "LIST":
+			body, ok := s.files[arg]
+			if cmd == "LIST" {
+				body, ok = s.dirs[arg]
+			}
+			if !ok {
+				reply("550 not found")
+				continue
+			}
+			reply("150 opening data connection")
+			data, err := openData()
+			if err != nil {
+				reply("425 cannot open data connection")
+				continue
+			}
+			io.WriteString(data, body[rest:])
+			data.Close()
+			rest = 0
+			reply("226 transfer complete")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 %s not implemented", cmd)
+		}
+	}
+}
+
+func TestRetrAndResume(t *testing.T) {
+	for _, active := range []bool{false, true} {
+		s := newTestServer(t)
+		c, err := Dial(s.ln.Addr().String(), Config{Active: active})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Login("user", "secret"); err != nil {
+			t.Fatal(err)
+		}
+
+		size, err := c.Size("pub/hello.txt")
+		if err != nil || size != 17 {
+			t.Fatalf("Size = %d, %v; want 17", size, err)
+		}
+
+		for _, offset := range []int64{0, 7} {
+			r, err := c.Retr("pub/hello.txt", offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _ := io.ReadAll(r)
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if want := s.files["pub/hello.txt"][offset:]; string(got) != want {
+				t.Errorf("active=%v offset=%d: got %q, want %q", active, offset, got, want)
+			}
+		}
+		c.Quit()
+	}
+}
+
+func TestLoginFailure(t *testing.T) {
+	s := newTestServer(t)
+	c, err := Dial(s.ln.Addr().String(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Login("user", "wrong"); err == nil {
+		t.Error("expected login with a wrong password to fail")
+	}
+}
+
+func TestList(t *testing.T) {
+	s := newTestServer(t)
+	c, err := Dial(s.ln.Addr().String(), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Quit()
+	if err := c.Login("user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := c.List("pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{{Name: "docs", Type: EntryDir, Size: 4096}, {Name: "hello.txt", Type: EntryFile, Size: 17}}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+}
+
+func TestParseListLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Entry
+		ok   bool
+	}{
+		{"-rw-r--r--   1 ftp           1024 Mar 03  2020 file name.txt", Entry{Name: "file name.txt", Size: 1024}, true},
+		{"lrwxrwxrwx   1 ftp  ftp         7 Jan 02 10:00 latest -> v1.2.3", Entry{Name: "latest", Type: EntryLink, Size: 7}, true},
+		{"01-02-20  10:00AM       <DIR>          pub", Entry{Name: "pub", Type: EntryDir}, true},
+		{"01-02-20  10:00AM                 1024 file.txt", Entry{Name: "file.txt", Size: 1024}, true},
+		{"drwxr-xr-x   2 ftp  ftp      4096 Jan 02 10:00 ..", Entry{}, false},
+		{"total 12", Entry{}, false},
+	}
+	for _, tc := range tests {
+		got, ok := ParseListLine(tc.line)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("ParseListLine(%q) = %+v, %v; want %+v, %v", tc.line, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package ftp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// EntryType distinguishes files, directories and symbolic links in a listing.
+type EntryType int
+
+const (
+	EntryFile EntryType = iota
+	EntryDir
+	EntryLink
+)
+
+// Entry is one line of a LIST reply.
+type Entry struct {
+	Name string
+	Type EntryType
+	Size int64
+}
+
+var months = map[string]bool{
+	"jan": true, "feb": true, "mar": true, "apr": true, "may": true, "jun": true,
+	"jul": true, "aug": true, "sep": true, "oct": true, "nov": true, "dec": true,
+}
+
+// ParseListLine parses a single line of a LIST reply in either the Unix
+// "ls -l" format or the DOS/IIS format. Totals, blank lines and the "." and
+// ".." entries are reported as not ok.
+func ParseListLine(line string) (Entry, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] == "total" {
+		return Entry{}, false
+	}
+
+	var e Entry
+	var ok bool
+	if strings.ContainsAny(fields[0][:1], "-dlbcps") && len(fields[0]) >= 10 {
+		e, ok = parseUnixLine(line, fields)
+	} else {
+		e, ok = parseDOSLine(line, fields)
+	}
+
+	if !ok || e.Name == "" || e.Name == "." || e.Name == ".." {
+		return Entry{}, false
+	}
+	return e, true
+}
+
+// parseUnixLine handles lines such as
+//
+//	drwxr-xr-x   2 ftp  ftp      4096 Jan 02 10:00 pub
+//	-rw-r--r--   1 ftp           1024 Mar 03  2020 file name.txt
+//	lrwxrwxrwx   1 ftp  ftp         7 Jan 02 10:00 latest -> v1.2.3
+//
+// The owner and group columns vary between servers, so the size is located
+// as the number preceding the month name.
+func parseUnixLine(line string, fields []string) (Entry, bool) {
+	month := -1
+	for i := 2; i+2 < len(fields); i++ {
+		if months[strings.ToLower(fields[i])] {
+			if _, err := strconv.ParseInt(fields[i-1], 10, 64); err == nil {
+				month = i
+				break
+			}
+		}
+	}
+	if month < 0 || month+3 >= len(fields) {
+		return Entry{}, false
+	}
+
+	size, _ := strconv.ParseInt(fields[month-1], 10, 64)
+	name := fieldRest(line, month+3)
+
+	e := Entry{Name: name, Size: size}
+	switch fields[0][0] {
+	case 'd':
+		e.Type = EntryDir
+	case 'l':
+		e.Type = EntryLink
+		if i := strings.Index(name, " -> "); i >= 0 {
+			e.Name = name[:i]
+		}
+	}
+	return e, true
+}
+
+// parseDOSLine handles lines such as
+//
+//	01-02-20  10:00AM       <DIR>          pub
+//	01-02-20  10:00AM                 1024 file.txt
+func parseDOSLine(line string, fields []string) (Entry, bool) {
+	if len(fields) < 4 || strings.Count(fields[0], "-") != 2 {
+		return Entry{}, false
+	}
+
+	e := Entry{Name: fieldRest(line, 3)}
+	if fields[2] == "<DIR>" {
+		e.Type = EntryDir
+		return e, true
+	}
+
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Entry{}, false
+	}
+	e.Size = size
+	return e, true
+}
+
+// fieldRest returns line from the start of its n-th whitespace-separated
+// field onwards, keeping any spaces inside a file name.
+func fieldRest(line string, n int) string {
+	rest := strings.TrimLeft(line, " \t")
+	for i := 0; i < n; i++ {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			return ""
+		}
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return rest
+}
@@ -49,7 +49,12 @@ func (l *Logger) Status(code int) {
 	if status == "" {
 		status = "Unknown Status"
 	}
-	fmt.Fprintf(l.Output, "sending request, awaiting response... status %d %s\n", code, status)
+	l.Reply(fmt.Sprintf("%d %s", code, status))
+}
+
+// Reply logs the server's response line for protocols without HTTP status codes.
+func (l *Logger) Reply(status string) {
+	fmt.Fprintf(l.Output, "sending request, awaiting response... status %s\n", status)
 }
 
 // Output the progress of download
@@ -116,6 +121,11 @@ func (l *Logger) Progress(written, total int64, speed float64, eta time.Duration
 	}
 }
 
+// Skipped logs a resource that was not downloaded and why.
+func (l *Logger) Skipped(url string, reason string) {
+	fmt.Fprintf(l.Output, "skipping %s: %s\n", url, reason)
+}
+
 // Error logs an error message.
 func (l *Logger) Error(err error) {
 	fmt.Fprintf(l.Output, "error: %v\n", err)
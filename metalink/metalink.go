@@ -0,0 +1,202 @@
+// Package metalink parses Metalink v4 documents (RFC 5854), which describe
+// files by their mirrors, sizes and whole-file and per-piece hashes.
+package metalink
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// MediaType is the Content-Type servers use for Metalink v4 documents.
+const MediaType = "application/metalink4+xml"
+
+// Metalink is a parsed Metalink v4 document.
+type Metalink struct {
+	Files []File `xml:"file"`
+}
+
+// File describes one file and where it can be retrieved from.
+type File struct {
+	Name   string  `xml:"name,attr"`
+	Size   int64   `xml:"size"`
+	Hashes []Hash  `xml:"hash"`
+	Pieces *Pieces `xml:"pieces"`
+	URLs   []URL   `xml:"url"`
+}
+
+// Hash is a whole-file hash, e.g. {"sha-256", "2f1b..."}.
+type Hash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Pieces holds the hashes of consecutive Length-byte pieces of a file.
+type Pieces struct {
+	Length int64    `xml:"length,attr"`
+	Type   string   `xml:"type,attr"`
+	Hashes []string `xml:"hash"`
+}
+
+// URL is a mirror for a file. Lower Priority values are preferred; 0 means
+// the document gave none.
+type URL struct {
+	Location string `xml:"location,attr"`
+	Priority int    `xml:"priority,attr"`
+	URL      string `xml:",chardata"`
+}
+
+// hashPreference lists supported hash types, strongest first.
+var hashPreference = []string{"sha-512", "sha-384", "sha-256", "sha-1", "md5"}
+
+// Parse reads a Metalink v4 document and checks that every file has a safe
+// relative name and at least one URL.
+func Parse(r io.Reader) (*Metalink, error) {
+	var m Metalink
+	if err := xml.NewDecoder(r).Decode(&m); err != nil {
+		return nil, fmt.Errorf("parsing metalink: %w", err)
+	}
+	if len(m.Files) == 0 {
+		return nil, fmt.Errorf("metalink describes no files")
+	}
+
+	for i := range m.Files {
+		f := &m.Files[i]
+		f.Name = strings.TrimSpace(f.Name)
+		clean := path.Clean(f.Name)
+		if f.Name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("metalink file name %q is not a safe relative path", f.Name)
+		}
+		f.Name = clean
+
+		for j := range f.URLs {
+			f.URLs[j].URL = strings.TrimSpace(f.URLs[j].URL)
+		}
+		for j := range f.Hashes {
+			f.Hashes[j].Type = strings.ToLower(f.Hashes[j].Type)
+			f.Hashes[j].Value = strings.ToLower(strings.TrimSpace(f.Hashes[j].Value))
+		}
+		if f.Pieces != nil {
+			f.Pieces.Type = strings.ToLower(f.Pieces.Type)
+			for j, h := range f.Pieces.Hashes {
+				f.Pieces.Hashes[j] = strings.ToLower(strings.TrimSpace(h))
+			}
+		}
+		if len(f.URLs) == 0 {
+			return nil, fmt.Errorf("metalink file %q lists no URLs", f.Name)
+		}
+	}
+	return &m, nil
+}
+
+// Mirrors returns f's URLs in the order they should be tried: those in
+// one of the preferred locations (ISO 3166 country codes) first, then by
+// priority. The document order breaks ties.
+func (f *File) Mirrors(preferred []string) []URL {
+	urls := append([]URL(nil), f.URLs...)
+
+	preferredRank := func(u URL) int {
+		for i, loc := range preferred {
+			if strings.EqualFold(u.Location, loc) {
+				return i
+			}
+		}
+		return len(preferred)
+	}
+	priority := func(u URL) int {
+		if u.Priority <= 0 {
+			return 999999
+		}
+		return u.Priority
+	}
+
+	sort.SliceStable(urls, func(i, j int) bool {
+		if ri, rj := preferredRank(urls[i]), preferredRank(urls[j]); ri != rj {
+			return ri < rj
+		}
+		return priority(urls[i]) < priority(urls[j])
+	})
+	return urls
+}
+
+// StrongestHash returns the strongest supported whole-file hash of f.
+func (f *File) StrongestHash() (Hash, bool) {
+	for _, t := range hashPreference {
+		for _, h := range f.Hashes {
+			if h.Type == t {
+				return h, true
+			}
+		}
+	}
+	return Hash{}, false
+}
+
+// PieceHashes reports whether f has piece hashes of a supported type.
+func (f *File) PieceHashes() bool {
+	if f.Pieces == nil || f.Pieces.Length <= 0 || len(f.Pieces.Hashes) == 0 {
+		return false
+	}
+	_, err := NewHash(f.Pieces.Type)
+	return err == nil
+}
+
+// VerifyPiece checks data against the hash of piece i.
+func (f *File) VerifyPiece(i int, data []byte) error {
+	h, err := NewHash(f.Pieces.Type)
+	if err != nil {
+		return err
+	}
+	if i >= len(f.Pieces.Hashes) {
+		return fmt.Errorf("%s: no hash for piece %d", f.Name, i)
+	}
+	h.Write(data)
+	if got := hex.EncodeToString(h.Sum(nil)); got != f.Pieces.Hashes[i] {
+		return fmt.Errorf("%s: piece %d has %s %s, want %s", f.Name, i, f.Pieces.Type, got, f.Pieces.Hashes[i])
+	}
+	return nil
+}
+
+// Verify checks the contents read from r against the strongest whole-file
+// hash of f. Files without a supported hash are accepted.
+func (f *File) Verify(r io.Reader) error {
+	want, ok := f.StrongestHash()
+	if !ok {
+		return nil
+	}
+	h, _ := NewHash(want.Type)
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want.Value {
+		return fmt.Errorf("%s: %s checksum mismatch: got %s, want %s", f.Name, want.Type, got, want.Value)
+	}
+	return nil
+}
+
+// NewHash returns a hash for a type from the IANA Hash Function Textual
+// Names registry.
+func NewHash(typ string) (hash.Hash, error) {
+	switch strings.ToLower(typ) {
+	case "md5":
+		return md5.New(), nil
+	case "sha-1":
+		return sha1.New(), nil
+	case "sha-256":
+		return sha256.New(), nil
+	case "sha-384":
+		return sha512.New384(), nil
+	case "sha-512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash type %q", typ)
+	}
+}
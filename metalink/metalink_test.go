@@ -0,0 +1,47 @@
+package metalink
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAndMirrorOrder(t *testing.T) {
+	doc := `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="dist/app.zip">
+    <size>3</size>
+    <hash type="SHA-256">BA7816BF8F01CFEA414140DE5DAE2223B00361A396177A9CB410FF61F20015AD</hash>
+    <hash type="md5">900150983cd24fb0d6963f7d28e17f72</hash>
+    <url location="us" priority="1">https://us.example.com/app.zip</url>
+    <url location="de" priority="2">https://de.example.com/app.zip</url>
+    <url>https://any.example.com/app.zip</url>
+  </file>
+</metalink>`
+	m, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &m.Files[0]
+
+	var order []string
+	for _, u := range f.Mirrors([]string{"DE"}) {
+		order = append(order, u.Location)
+	}
+	if got := strings.Join(order, ","); got != "de,us," {
+		t.Errorf("mirror order = %q, want %q", got, "de,us,")
+	}
+
+	if h, _ := f.StrongestHash(); h.Type != "sha-256" {
+		t.Errorf("strongest hash = %q", h.Type)
+	}
+	if err := f.Verify(strings.NewReader("abc")); err != nil {
+		t.Error(err)
+	}
+	if err := f.Verify(strings.NewReader("abd")); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+
+	unsafe := strings.Replace(doc, `name="dist/app.zip"`, `name="../../etc/passwd"`, 1)
+	if _, err := Parse(strings.NewReader(unsafe)); err == nil {
+		t.Error("expected a file name climbing out of the output directory to be rejected")
+	}
+}
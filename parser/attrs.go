@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlAttr is an attribute of an element that holds a URL.
+type urlAttr struct {
+	index     int  // position in the element's Attr
+	requisite bool // the URL is needed to render the page, not navigated to
+	srcset    bool // the value is a srcset list of URLs with descriptors
+}
+
+// requisiteRels are the <link rel> types whose target is part of the page.
+var requisiteRels = []string{"stylesheet", "icon", "apple-touch-icon", "apple-touch-icon-precomposed", "mask-icon", "preload", "modulepreload"}
+
+// urlAttrs returns the attributes of n that reference other resources:
+// links to navigate to (<a>, <area>, most <link>s) and page requisites
+// (scripts, images including srcset and <picture> sources, media and
+// their tracks, frames, embedded objects, stylesheets, favicons, image
+// inputs and og:image).
+func urlAttrs(n *html.Node) []urlAttr {
+	var keys []string
+	requisite := true
+	switch n.Data {
+	case "a", "area":
+		keys, requisite = []string{"href"}, false
+	case "link":
+		rel := attrValue(n, "rel")
+		keys = []string{"href"}
+		requisite = slices.ContainsFunc(requisiteRels, func(r string) bool { return hasToken(rel, r) })
+	case "img", "source":
+		keys = []string{"src", "srcset"}
+	case "script", "iframe", "frame", "embed", "audio", "track":
+		keys = []string{"src"}
+	case "video":
+		keys = []string{"src", "poster"}
+	case "object":
+		keys = []string{"data"}
+	case "input":
+		if strings.EqualFold(attrValue(n, "type"), "image") {
+			keys = []string{"src"}
+		}
+	case "meta":
+		switch strings.ToLower(attrValue(n, "property")) {
+		case "og:image", "og:image:url", "og:image:secure_url":
+			keys = []string{"content"}
+		}
+	}
+
+	var attrs []urlAttr
+	for i, a := range n.Attr {
+		if slices.Contains(keys, a.Key) {
+			attrs = append(attrs, urlAttr{index: i, requisite: requisite, srcset: a.Key == "srcset"})
+		}
+	}
+	return attrs
+}
+
+// srcsetCandidate is one image in a srcset: its URL and optional width or
+// density descriptor.
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset splits a srcset attribute into its candidates, following the
+// HTML rule that a URL ends at whitespace and a trailing comma ends the
+// candidate.
+func parseSrcset(s string) []srcsetCandidate {
+	var out []srcsetCandidate
+	for {
+		s = strings.TrimLeft(s, " \t\n\r\f,")
+		if s == "" {
+			return out
+		}
+		end := strings.IndexAny(s, " \t\n\r\f")
+		if end < 0 {
+			end = len(s)
+		}
+		c := srcsetCandidate{url: s[:end]}
+		s = s[end:]
+		if strings.HasSuffix(c.url, ",") {
+			c.url = strings.TrimRight(c.url, ",")
+		} else {
+			desc, rest, _ := strings.Cut(s, ",")
+			c.descriptor = strings.TrimSpace(desc)
+			s = rest
+		}
+		if c.url != "" {
+			out = append(out, c)
+		}
+	}
+}
+
+// formatSrcset joins candidates back into a srcset attribute value.
+func formatSrcset(candidates []srcsetCandidate) string {
+	parts := make([]string, len(candidates))
+	for i, c := range candidates {
+		parts[i] = c.url
+		if c.descriptor != "" {
+			parts[i] += " " + c.descriptor
+		}
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,288 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// cssRef is a URL referenced by a stylesheet: the target of an @import or a
+// url() token.
+type cssRef struct {
+	start, end int    // byte range of the whole token, e.g. url("a.png") or "b.css"
+	url        string // the URL with CSS escapes resolved
+	function   bool   // written as url(...) rather than a bare string
+}
+
+// ExtractStylesheet reads a CSS file and returns the http and https URLs it
+// references through @import and url(), all of them page requisites.
+func ExtractStylesheet(baseURL *url.URL, r io.Reader) (*Page, error) {
+	css, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &Page{}
+	seen := make(map[string]bool)
+	for _, ref := range cssRefs(string(css)) {
+		u, err := baseURL.Parse(strings.TrimSpace(ref.url))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			continue
+		}
+		u.Fragment, u.RawFragment = "", ""
+		if seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		page.Links = append(page.Links, Link{URL: u.String(), Requisite: true})
+	}
+	return page, nil
+}
+
+// RewriteStylesheet rewrites the @import and url() references of a CSS file
+// that localPath maps to a local file to be relative to cssDir, the
+// directory the stylesheet is saved in. Other references are left as they
+// are.
+func RewriteStylesheet(css []byte, sheetURL *url.URL, cssDir string, localPath func(*url.URL) (string, bool)) []byte {
+	return []byte(rewriteCSS(string(css), func(ref string) (string, bool) {
+		return localLink(ref, sheetURL, cssDir, localPath)
+	}))
+}
+
+// rewriteCSS replaces every reference in css for which localize returns a
+// new URL.
+func rewriteCSS(css string, localize func(string) (string, bool)) string {
+	var out strings.Builder
+	last := 0
+	for _, ref := range cssRefs(css) {
+		rel, ok := localize(ref.url)
+		if !ok {
+			continue
+		}
+		out.WriteString(css[last:ref.start])
+		if ref.function {
+			out.WriteString("url(" + cssQuote(rel) + ")")
+		} else {
+			out.WriteString(cssQuote(rel))
+		}
+		last = ref.end
+	}
+	if last == 0 {
+		return css
+	}
+	out.WriteString(css[last:])
+	return out.String()
+}
+
+// cssRefs tokenizes css, following the CSS Syntax Module Level 3 rules for
+// comments, strings, escapes and url tokens, and returns the targets of
+// @import rules and url() functions in order.
+func cssRefs(css string) []cssRef {
+	var refs []cssRef
+	inImport := false // after @import, before its URL
+	i := 0
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case strings.HasPrefix(css[i:], "/*"):
+			end := strings.Index(css[i+2:], "*/")
+			if end < 0 {
+				return refs
+			}
+			i += end + 4
+
+		case isCSSSpace(c):
+			i++
+
+		case c == '"' || c == '\'':
+			value, end := cssString(css, i)
+			if inImport {
+				refs = append(refs, cssRef{start: i, end: end, url: value})
+				inImport = false
+			}
+			i = end
+
+		case c == '@':
+			name, end := cssIdent(css, i+1)
+			inImport = strings.EqualFold(name, "import")
+			i = max(end, i+1)
+
+		case startsCSSIdent(css[i:]):
+			name, end := cssIdent(css, i)
+			if end < len(css) && css[end] == '(' && strings.EqualFold(name, "url") {
+				if value, urlEnd, ok := cssURL(css, end+1); ok {
+					refs = append(refs, cssRef{start: i, end: urlEnd, url: value, function: true})
+					inImport = false
+					i = urlEnd
+					continue
+				}
+			}
+			inImport = false
+			i = end
+
+		case c == '\\':
+			inImport = false
+			i += 2
+
+		default:
+			inImport = false
+			i++
+		}
+	}
+	return refs
+}
+
+// cssURL parses the rest of a url( function starting at i, either a quoted
+// string or an unquoted URL, and returns its value and the index after ")".
+func cssURL(css string, i int) (string, int, bool) {
+	for i < len(css) && isCSSSpace(css[i]) {
+		i++
+	}
+	if i < len(css) && (css[i] == '"' || css[i] == '\'') {
+		value, end := cssString(css, i)
+		for end < len(css) && isCSSSpace(css[end]) {
+			end++
+		}
+		if end >= len(css) || css[end] != ')' {
+			return "", 0, false
+		}
+		return value, end + 1, true
+	}
+
+	var value strings.Builder
+	for i < len(css) {
+		switch c := css[i]; {
+		case c == ')':
+			return strings.TrimRight(value.String(), " \t\n\r\f"), i + 1, true
+		case c == '\\':
+			r, end := cssEscape(css, i+1)
+			value.WriteRune(r)
+			i = end
+		case c == '"' || c == '\'' || c == '(':
+			// A bad url token
+			return "", 0, false
+		default:
+			value.WriteByte(c)
+			i++
+		}
+	}
+	return "", 0, false
+}
+
+// cssString parses the string starting with the quote at i and returns its
+// value and the index after the closing quote. An unterminated string ends
+// at a newline or the end of the input.
+func cssString(css string, i int) (string, int) {
+	quote := css[i]
+	var value strings.Builder
+	i++
+	for i < len(css) {
+		switch c := css[i]; c {
+		case quote:
+			return value.String(), i + 1
+		case '\n':
+			return value.String(), i
+		case '\\':
+			if i+1 < len(css) && css[i+1] == '\n' {
+				i += 2
+				continue
+			}
+			r, end := cssEscape(css, i+1)
+			value.WriteRune(r)
+			i = end
+		default:
+			value.WriteByte(c)
+			i++
+		}
+	}
+	return value.String(), i
+}
+
+// cssIdent reads the identifier starting at i and returns it and the index
+// after it.
+func cssIdent(css string, i int) (string, int) {
+	var name strings.Builder
+	for i < len(css) {
+		c := css[i]
+		switch {
+		case c == '\\':
+			r, end := cssEscape(css, i+1)
+			name.WriteRune(r)
+			i = end
+		case c == '-' || c == '_' || c >= 0x80 || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9'):
+			name.WriteByte(c)
+			i++
+		default:
+			return name.String(), i
+		}
+	}
+	return name.String(), i
+}
+
+// cssEscape decodes the escape whose backslash precedes i: up to six hex
+// digits and one optional whitespace character, or any other single
+// character.
+func cssEscape(css string, i int) (rune, int) {
+	if i >= len(css) {
+		return utf8.RuneError, i
+	}
+	j := i
+	for j < len(css) && j-i < 6 && isHexDigit(css[j]) {
+		j++
+	}
+	if j == i {
+		r, size := utf8.DecodeRuneInString(css[i:])
+		return r, i + size
+	}
+	n, _ := strconv.ParseUint(css[i:j], 16, 32)
+	if j < len(css) && isCSSSpace(css[j]) {
+		j++
+	}
+	if n == 0 || n > utf8.MaxRune || (n >= 0xD800 && n <= 0xDFFF) {
+		return utf8.RuneError, j
+	}
+	return rune(n), j
+}
+
+// startsCSSIdent reports whether s starts with an identifier.
+func startsCSSIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	c := s[0]
+	if c == '-' {
+		return len(s) > 1 && (s[1] == '-' || startsCSSIdent(s[1:]))
+	}
+	return c == '_' || c >= 0x80 || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') ||
+		(c == '\\' && len(s) > 1 && s[1] != '\n')
+}
+
+// cssQuote returns s as a single-quoted CSS string.
+func cssQuote(s string) string {
+	var b bytes.Buffer
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\a `)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func isCSSSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
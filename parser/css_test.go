@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSSRefs(t *testing.T) {
+	css := `@import "base.css";
+@import url(print.css) print;
+/* url(commented.png) @import "no.css"; */
+body { background: URL( "bg image.png" ) no-repeat; content: "url(not-a-ref.png)"; }
+@font-face { src: url(fonts/a\).woff2) format("woff2"), url('fonts/\62 .woff'); }
+.x { background-image: url(  spaced.png  ); }
+.y::before { content: "@import"; }
+.z { background: url(data:image/png;base64,AAAA) }`
+	var got []string
+	for _, ref := range cssRefs(css) {
+		got = append(got, ref.url)
+	}
+	want := []string{"base.css", "print.css", "bg image.png", "fonts/a).woff2", "fonts/b.woff", "spaced.png", "data:image/png;base64,AAAA"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cssRefs = %q, want %q", got, want)
+	}
+}
+
+func TestRewriteStylesheet(t *testing.T) {
+	sheet, _ := url.Parse("http://example.com/css/site.css")
+	css := `@import "theme.css"; a { background: url(/img/a.png) } b { background: url(http://other.test/b.png) }`
+	local := func(u *url.URL) (string, bool) {
+		if u.Host != "example.com" {
+			return "", false
+		}
+		return path.Join("/out/example.com", u.Path), true
+	}
+	got := string(RewriteStylesheet([]byte(css), sheet, "/out/example.com/css", local))
+	want := `@import 'theme.css'; a { background: url('../img/a.png') } b { background: url(http://other.test/b.png) }`
+	if got != want {
+		t.Errorf("RewriteStylesheet =\n%s\nwant\n%s", got, want)
+	}
+
+	page, err := ExtractStylesheet(sheet, strings.NewReader(css))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Links) != 3 || page.Links[0].URL != "http://example.com/css/theme.css" || !page.Links[0].Requisite {
+		t.Errorf("ExtractStylesheet = %v", page.Links)
+	}
+}
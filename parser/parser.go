@@ -3,77 +3,127 @@ package parser
 import (
 	"io"
 	"net/url"
-	"regexp"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-// regex to capture the contents of url(...)
-var cssURLRe = regexp.MustCompile(`url\(\s*['"]?([^)'"]+)['"]?\s*\)`)
+// Link is a URL referenced by a page.
+type Link struct {
+	URL       string
+	NoFollow  bool // every reference to URL carries rel="nofollow"
+	Requisite bool // some reference to URL embeds it in the page (image, script, stylesheet, ...)
+}
+
+// Page holds what ExtractPage finds in an HTML document.
+type Page struct {
+	Links     []Link
+	NoFollow  bool   // <meta name="robots"> asks crawlers not to follow any link
+	Canonical string // the URL of <link rel="canonical">, if any
+}
 
-// ExtractLinks parses HTML from the reader and returns internal asset URLs.
-// It extracts href/src from <a>, <link>, <img> tags and url(...) in CSS.
+// ExtractLinks parses HTML from the reader and returns the http and https
+// URLs it references, on any host; the caller decides which to follow.
+// It extracts href/src from <a>, <link>, <img>, <script>, media, frame and
+// object tags, srcset lists, og:image, and url(...) in CSS.
 func ExtractLinks(baseURL *url.URL, r io.Reader) ([]string, error) {
+	page, err := ExtractPage(baseURL, r)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]string, len(page.Links))
+	for i, l := range page.Links {
+		links[i] = l.URL
+	}
+	return links, nil
+}
+
+// ExtractPage is ExtractLinks with the hints a crawler needs: which links
+// are page requisites, rel="nofollow" on individual links, a nofollow or
+// none directive in <meta name="robots"> and the canonical URL. Links are
+// resolved against the document's <base href> if it has one, otherwise
+// against baseURL, the URL of the page itself. The target of a
+// <meta http-equiv="refresh"> redirect is a link too.
+func ExtractPage(baseURL *url.URL, r io.Reader) (*Page, error) {
 	doc, err := html.Parse(r)
 	if err != nil {
 		return nil, err
 	}
+	baseURL = documentBase(doc, baseURL)
 
-	var links []string
-	visited := make(map[string]bool)
+	page := &Page{}
+	index := make(map[string]int)
 
-	addLink := func(raw string) {
+	addLink := func(raw string, noFollow, requisite bool) {
 		href := strings.TrimSpace(raw)
 		if href == "" {
 			return
 		}
 		u, err := baseURL.Parse(href)
-		if err != nil || u.Host != baseURL.Host {
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
 			return
 		}
+		// The fragment names a place in the page, not another resource
+		u.Fragment, u.RawFragment = "", ""
 		clean := u.String()
-		if !visited[clean] {
-			visited[clean] = true
-			links = append(links, clean)
+		if i, ok := index[clean]; ok {
+			page.Links[i].NoFollow = page.Links[i].NoFollow && noFollow
+			page.Links[i].Requisite = page.Links[i].Requisite || requisite
+			return
 		}
+		index[clean] = len(page.Links)
+		page.Links = append(page.Links, Link{URL: clean, NoFollow: noFollow, Requisite: requisite})
 	}
 
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
-			// 1) handle <a>, <link>, <img>
-			var key string
-			switch n.Data {
-			case "a", "link":
-				key = "href"
-			case "img":
-				key = "src"
+			// 1) handle attributes holding URLs: <a href>, <img src srcset>, <script src>, ...
+			noFollow := hasToken(attrValue(n, "rel"), "nofollow")
+			for _, a := range urlAttrs(n) {
+				val := n.Attr[a.index].Val
+				if !a.srcset {
+					addLink(val, noFollow, a.requisite)
+					continue
+				}
+				for _, c := range parseSrcset(val) {
+					addLink(c.url, noFollow, a.requisite)
+				}
 			}
-			if key != "" {
-				for _, attr := range n.Attr {
-					if attr.Key == key {
-						addLink(attr.Val)
-					}
+
+			if n.Data == "meta" && strings.EqualFold(attrValue(n, "name"), "robots") {
+				content := attrValue(n, "content")
+				if hasToken(content, "nofollow") || hasToken(content, "none") {
+					page.NoFollow = true
+				}
+			}
+
+			if n.Data == "meta" && strings.EqualFold(attrValue(n, "http-equiv"), "refresh") {
+				content := attrValue(n, "content")
+				if start, end, ok := refreshTarget(content); ok {
+					addLink(content[start:end], false, false)
+				}
+			}
+
+			if n.Data == "link" && page.Canonical == "" && hasToken(attrValue(n, "rel"), "canonical") {
+				if u, err := baseURL.Parse(strings.TrimSpace(attrValue(n, "href"))); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					page.Canonical = u.String()
 				}
 			}
 
 			// 2) handle <style> tags
 			if n.Data == "style" && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
-				css := n.FirstChild.Data
-				matches := cssURLRe.FindAllStringSubmatch(css, -1)
-				for _, m := range matches {
-					addLink(m[1])
+				for _, ref := range cssRefs(n.FirstChild.Data) {
+					addLink(ref.url, false, true)
 				}
 			}
 
 			// 3) handle inline style attributes
 			for _, attr := range n.Attr {
 				if attr.Key == "style" {
-					css := attr.Val
-					matches := cssURLRe.FindAllStringSubmatch(css, -1)
-					for _, m := range matches {
-						addLink(m[1])
+					for _, ref := range cssRefs(attr.Val) {
+						addLink(ref.url, false, true)
 					}
 				}
 			}
@@ -85,5 +135,104 @@ func ExtractLinks(baseURL *url.URL, r io.Reader) ([]string, error) {
 	}
 
 	traverse(doc)
-	return links, nil
+	return page, nil
+}
+
+// documentBase returns the URL links in doc are relative to: the href of its
+// first <base> element, resolved against pageURL, or pageURL itself.
+func documentBase(doc *html.Node, pageURL *url.URL) *url.URL {
+	if n := baseElement(doc); n != nil {
+		if u, err := pageURL.Parse(strings.TrimSpace(attrValue(n, "href"))); err == nil {
+			return u
+		}
+	}
+	return pageURL
+}
+
+// baseElement returns the first <base> element of doc with an href.
+func baseElement(n *html.Node) *html.Node {
+	if n.Type == html.ElementNode && n.Data == "base" && hasAttr(n, "href") {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if b := baseElement(c); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// htmlSpace holds the ASCII whitespace characters of HTML.
+const htmlSpace = " \t\n\r\f"
+
+// refreshTarget finds the URL in the content of <meta http-equiv="refresh">,
+// e.g. "5; url='/next.html'", and returns its byte range.
+func refreshTarget(content string) (start, end int, ok bool) {
+	i := 0
+	skip := func(chars string) {
+		for i < len(content) && strings.IndexByte(chars, content[i]) >= 0 {
+			i++
+		}
+	}
+	skip(htmlSpace)
+	skip("0123456789.")
+	skip(htmlSpace)
+	if i < len(content) && (content[i] == ';' || content[i] == ',') {
+		i++
+	}
+	skip(htmlSpace)
+	if len(content)-i >= 3 && strings.EqualFold(content[i:i+3], "url") {
+		j := i + 3
+		for j < len(content) && strings.IndexByte(htmlSpace, content[j]) >= 0 {
+			j++
+		}
+		if j < len(content) && content[j] == '=' {
+			i = j + 1
+			skip(htmlSpace)
+		}
+	}
+	if i >= len(content) {
+		return 0, 0, false
+	}
+
+	end = len(content)
+	if q := content[i]; q == '"' || q == '\'' {
+		i++
+		if k := strings.IndexByte(content[i:], q); k >= 0 {
+			end = i + k
+		}
+	}
+	end = i + len(strings.TrimRight(content[i:end], htmlSpace))
+	return i, end, end > i
+}
+
+// hasAttr reports whether n has the attribute key.
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// attrValue returns the value of n's attribute key, or "".
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether a space- or comma-separated list contains token,
+// ignoring case.
+func hasToken(list, token string) bool {
+	for _, t := range strings.FieldsFunc(list, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	got := parseSrcset(" a.png, b,1.png 2x,c.png 640w ,\n d.png")
+	want := []srcsetCandidate{{"a.png", ""}, {"b,1.png", "2x"}, {"c.png", "640w"}, {"d.png", ""}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSrcset = %q, want %q", got, want)
+	}
+	if s := formatSrcset(want); s != "a.png, b,1.png 2x, c.png 640w, d.png" {
+		t.Errorf("formatSrcset = %q", s)
+	}
+}
+
+func TestExtractPageRequisites(t *testing.T) {
+	base, _ := url.Parse("http://example.com/dir/page.html")
+	page, err := ExtractPage(base, strings.NewReader(`<a href="next.html">n</a>
+<link rel="stylesheet" href="/s.css"><link rel="alternate" href="/feed.xml">
+<picture><source srcset="/p.webp 1x, /p2.webp 2x"><img src="p.png"></picture>
+<a href="p.png">full size</a><a href="mailto:me@example.com">mail</a>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"http://example.com/dir/next.html": false,
+		"http://example.com/s.css":         true,
+		"http://example.com/feed.xml":      false,
+		"http://example.com/p.webp":        true,
+		"http://example.com/p2.webp":       true,
+		"http://example.com/dir/p.png":     true,
+	}
+	if len(page.Links) != len(want) {
+		t.Fatalf("found %d links, want %d: %v", len(page.Links), len(want), page.Links)
+	}
+	for _, l := range page.Links {
+		if req, ok := want[l.URL]; !ok || req != l.Requisite {
+			t.Errorf("link %s: requisite %v, want %v (known %v)", l.URL, l.Requisite, req, ok)
+		}
+	}
+}
+
+func TestExtractPageBaseRefreshCanonical(t *testing.T) {
+	pageURL, _ := url.Parse("http://example.com/a/b/page.html")
+	page, err := ExtractPage(pageURL, strings.NewReader(`<head>
+<meta http-equiv="Refresh" content="3; URL='moved.html'">
+<link rel="canonical" href="/a/b/page.html?lang=en">
+</head><body><a href="x.html">x</a><base href="/static/"><base href="/ignored/"></body>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range page.Links {
+		got = append(got, l.URL)
+	}
+	want := []string{"http://example.com/static/moved.html", "http://example.com/a/b/page.html?lang=en", "http://example.com/static/x.html"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("links = %q, want %q", got, want)
+	}
+	if page.Canonical != "http://example.com/a/b/page.html?lang=en" {
+		t.Errorf("canonical = %q", page.Canonical)
+	}
+}
+
+func TestRefreshTarget(t *testing.T) {
+	cases := map[string]string{
+		"0;url=/next.html":      "/next.html",
+		"5 ; URL = 'a b.html' ": "a b.html",
+		`0, "q.html"`:           "q.html",
+		"0; /plain.html ":       "/plain.html",
+		"10":                    "",
+	}
+	for content, want := range cases {
+		start, end, ok := refreshTarget(content)
+		if got := content[start:end]; ok != (want != "") || got != want {
+			t.Errorf("refreshTarget(%q) = %q, %v, want %q", content, got, ok, want)
+		}
+	}
+}
+
+func TestRewriteLinksDropsBase(t *testing.T) {
+	pageURL, _ := url.Parse("http://example.com/docs/index.html")
+	html := `<head><base href="http://example.com/assets/"><meta http-equiv="refresh" content="0; url=next.html"></head><img src="a.png">`
+	local := func(u *url.URL) (string, bool) { return "/out/example.com" + u.Path, true }
+	out, err := RewriteLinks([]byte(html), pageURL, "/out/example.com/docs", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if strings.Contains(s, "<base") || !strings.Contains(s, `src="../assets/a.png"`) || !strings.Contains(s, `content="0; url=../assets/next.html"`) {
+		t.Errorf("RewriteLinks = %s", s)
+	}
+}
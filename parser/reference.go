@@ -10,81 +10,70 @@ import (
 	"golang.org/x/net/html"
 )
 
-// RewriteLinks parses the HTML in inBuf, and for each internal link (a[href], img[src], link[href], style attributes),
-// rewrites it to be relative to the HTML file’s location.
-func RewriteLinks(inBuf []byte, pageURL *url.URL, domainDir, htmlDir string) ([]byte, error) {
+// RewriteLinks parses the HTML in inBuf, and for each link found by ExtractPage (a[href], img[src] and srcset,
+// script[src], link[href], style attributes, meta refresh, ...) that localPath maps to a local file, rewrites it to be
+// relative to the HTML file’s location, htmlDir. Links for which localPath reports false are left as they are.
+func RewriteLinks(inBuf []byte, pageURL *url.URL, htmlDir string, localPath func(*url.URL) (string, bool)) ([]byte, error) {
 	doc, err := html.Parse(bytes.NewReader(inBuf))
 	if err != nil {
 		return nil, fmt.Errorf("parsing HTML: %w", err)
 	}
 
-	// Rewrite CSS url(...) to relative path
-	replaceCSSURLs := func(css string) string {
-		return cssURLRe.ReplaceAllStringFunc(css, func(match string) string {
-			matches := cssURLRe.FindStringSubmatch(match)
-			if len(matches) < 2 {
-				return match
-			}
-			orig := strings.TrimSpace(matches[1])
-			u, err := pageURL.Parse(orig)
-			if err != nil || u.Host != pageURL.Host {
-				return match
-			}
-			localAbs := filepath.Join(domainDir, filepath.FromSlash(u.Path))
-			rel, err := filepath.Rel(htmlDir, localAbs)
-			if err != nil {
-				rel = filepath.ToSlash(u.Path)
-			} else {
-				rel = filepath.ToSlash(rel)
-			}
-			return fmt.Sprintf("url('%s')", rel)
-		})
+	// Links are resolved against <base href>, which is then removed as the
+	// rewritten links are relative to the local copy
+	baseURL := documentBase(doc, pageURL)
+	if base := baseElement(doc); base != nil {
+		base.Parent.RemoveChild(base)
+	}
+	localize := func(ref string) (string, bool) {
+		return localLink(ref, baseURL, htmlDir, localPath)
 	}
 
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
-			// Handle standard tags: a[href], link[href], img[src]
-			var key string
-			switch n.Data {
-			case "a", "link":
-				key = "href"
-			case "img":
-				key = "src"
+			// Handle attributes holding URLs: a[href], img[src], img[srcset], ...
+			for _, a := range urlAttrs(n) {
+				attr := &n.Attr[a.index]
+				if !a.srcset {
+					if rel, ok := localize(attr.Val); ok {
+						attr.Val = rel
+					}
+					continue
+				}
+				candidates := parseSrcset(attr.Val)
+				for i, c := range candidates {
+					if rel, ok := localize(c.url); ok {
+						candidates[i].url = rel
+					}
+				}
+				attr.Val = formatSrcset(candidates)
 			}
-			if key != "" {
+
+			// Handle <meta http-equiv="refresh" content="0; url=...">
+			if n.Data == "meta" && strings.EqualFold(attrValue(n, "http-equiv"), "refresh") {
 				for i, attr := range n.Attr {
-					if attr.Key == key {
-						orig := strings.TrimSpace(attr.Val)
-						if orig == "" {
-							continue
-						}
-						u, err := pageURL.Parse(orig)
-						if err != nil || u.Host != pageURL.Host {
-							continue
-						}
-						localAbs := filepath.Join(domainDir, filepath.FromSlash(u.Path))
-						rel, err := filepath.Rel(htmlDir, localAbs)
-						if err != nil {
-							rel = filepath.ToSlash(u.Path)
-						} else {
-							rel = filepath.ToSlash(rel)
+					if attr.Key != "content" {
+						continue
+					}
+					if start, end, ok := refreshTarget(attr.Val); ok {
+						if rel, ok := localize(attr.Val[start:end]); ok {
+							n.Attr[i].Val = attr.Val[:start] + rel + attr.Val[end:]
 						}
-						n.Attr[i].Val = rel
 					}
 				}
 			}
 
 			// Handle inline style="..."
 			for i, attr := range n.Attr {
-				if attr.Key == "style" && strings.Contains(attr.Val, "url(") {
-					n.Attr[i].Val = replaceCSSURLs(attr.Val)
+				if attr.Key == "style" {
+					n.Attr[i].Val = rewriteCSS(attr.Val, localize)
 				}
 			}
 
 			// Handle <style> blocks
 			if n.Data == "style" && n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
-				n.FirstChild.Data = replaceCSSURLs(n.FirstChild.Data)
+				n.FirstChild.Data = rewriteCSS(n.FirstChild.Data, localize)
 			}
 		}
 
@@ -100,3 +89,29 @@ func RewriteLinks(inBuf []byte, pageURL *url.URL, domainDir, htmlDir string) ([]
 	}
 	return out.Bytes(), nil
 }
+
+// localLink resolves ref against baseURL and returns a link to its local
+// copy relative to dir, or false if localPath reports it has none. The file
+// name is escaped, so that a saved "page?id=1" is not read as a query, and
+// the fragment is kept.
+func localLink(ref string, baseURL *url.URL, dir string, localPath func(*url.URL) (string, bool)) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return "", false
+	}
+	u, err := baseURL.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	fragment := u.Fragment
+	u.Fragment, u.RawFragment = "", ""
+	localAbs, ok := localPath(u)
+	if !ok {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, localAbs)
+	if err != nil {
+		return "", false
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel), Fragment: fragment}).String(), true
+}
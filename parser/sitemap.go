@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// maxSitemapSize is the largest uncompressed sitemap the protocol allows.
+const maxSitemapSize = 50 << 20
+
+// SitemapEntry is a <url> or <sitemap> element of a sitemap.
+type SitemapEntry struct {
+	Loc     string
+	LastMod time.Time // zero if absent or unparsable
+}
+
+// Sitemap is a parsed sitemap: either a list of page URLs or, for a
+// sitemap index, a list of further sitemaps.
+type Sitemap struct {
+	URLs     []SitemapEntry
+	Sitemaps []SitemapEntry
+}
+
+type sitemapXML struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntryXML `xml:"url"`
+	Sitemaps []sitemapEntryXML `xml:"sitemap"`
+}
+
+type sitemapEntryXML struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// ParseSitemap reads an XML sitemap or sitemap index as defined at
+// sitemaps.org. Gzip-compressed input is detected and decompressed.
+func ParseSitemap(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	var in io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		in = gz
+	}
+
+	var doc sitemapXML
+	if err := xml.NewDecoder(io.LimitReader(in, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing sitemap: %w", err)
+	}
+	if doc.XMLName.Local != "urlset" && doc.XMLName.Local != "sitemapindex" {
+		return nil, fmt.Errorf("parsing sitemap: unexpected root element <%s>", doc.XMLName.Local)
+	}
+
+	sm := &Sitemap{}
+	for _, e := range doc.URLs {
+		if loc := strings.TrimSpace(e.Loc); loc != "" {
+			sm.URLs = append(sm.URLs, SitemapEntry{Loc: loc, LastMod: parseW3CDate(e.LastMod)})
+		}
+	}
+	for _, e := range doc.Sitemaps {
+		if loc := strings.TrimSpace(e.Loc); loc != "" {
+			sm.Sitemaps = append(sm.Sitemaps, SitemapEntry{Loc: loc, LastMod: parseW3CDate(e.LastMod)})
+		}
+	}
+	return sm, nil
+}
+
+// parseW3CDate parses the W3C Datetime profile used by <lastmod>.
+func parseW3CDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
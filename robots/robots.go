@@ -0,0 +1,194 @@
+// Package robots parses robots.txt files as specified by RFC 9309, plus the
+// widely used Crawl-delay and Sitemap extensions.
+package robots
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules are the robots.txt rules that apply to one user agent.
+type Rules struct {
+	rules      []rule
+	CrawlDelay time.Duration // minimum time between requests, 0 if unset
+	Sitemaps   []string      // Sitemap URLs listed anywhere in the file
+}
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// AllowAll returns rules that permit everything, used when a site has no
+// robots.txt.
+func AllowAll() *Rules {
+	return &Rules{}
+}
+
+// DisallowAll returns rules that forbid everything, used when robots.txt
+// could not be retrieved because the server failed.
+func DisallowAll() *Rules {
+	return &Rules{rules: []rule{{allow: false, pattern: "/"}}}
+}
+
+// group is a set of User-agent lines and the rules that follow them.
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Parse reads a robots.txt file and returns the rules for agent, the
+// product token of the crawler (e.g. "wget"). Groups naming the agent,
+// compared without regard to case, take precedence over the "*" group;
+// several matching groups are merged.
+func Parse(r io.Reader, agent string) (*Rules, error) {
+	agent = strings.ToLower(agent)
+
+	var groups []*group
+	var cur *group
+	inAgents := false // the previous line was a User-agent line
+	var sitemaps []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents || cur == nil {
+				cur = &group{}
+				groups = append(groups, cur)
+			}
+			cur.agents = append(cur.agents, productToken(value))
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			// An empty Disallow allows everything and adds nothing
+			if cur != nil && value != "" {
+				cur.rules = append(cur.rules, rule{allow: key == "allow", pattern: value})
+			}
+		case "crawl-delay":
+			if cur != nil {
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					cur.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		case "sitemap":
+			sitemaps = append(sitemaps, value)
+		}
+		inAgents = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{Sitemaps: sitemaps}
+	matched := false
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a != "*" && a != "" && a == agent {
+				rules.add(g)
+				matched = true
+				break
+			}
+		}
+	}
+	if !matched {
+		for _, g := range groups {
+			for _, a := range g.agents {
+				if a == "*" {
+					rules.add(g)
+					break
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// productToken returns the lower-cased product token a User-agent line
+// names: its leading letters, "-" and "_", so "Wget/1.21" names "wget".
+func productToken(value string) string {
+	if value == "*" {
+		return value
+	}
+	end := strings.IndexFunc(value, func(c rune) bool {
+		return !(c == '-' || c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'))
+	})
+	if end >= 0 {
+		value = value[:end]
+	}
+	return strings.ToLower(value)
+}
+
+func (r *Rules) add(g *group) {
+	r.rules = append(r.rules, g.rules...)
+	if g.crawlDelay > r.CrawlDelay {
+		r.CrawlDelay = g.crawlDelay
+	}
+}
+
+// Allowed reports whether a URL path (including any query) may be crawled.
+// The most specific, i.e. longest, matching rule decides, and Allow wins
+// a tie.
+func (r *Rules) Allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	best := -1
+	allowed := true
+	for _, rl := range r.rules {
+		if !match(rl.pattern, path) {
+			continue
+		}
+		if n := len(rl.pattern); n > best || (n == best && rl.allow) {
+			best = n
+			allowed = rl.allow
+		}
+	}
+	return allowed
+}
+
+// match reports whether path matches a robots.txt pattern, in which "*"
+// matches any sequence of characters and a trailing "$" anchors the end.
+func match(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		j := strings.Index(path[pos:], part)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(part)
+	}
+	return !anchored || pos == len(path)
+}
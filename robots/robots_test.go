@@ -0,0 +1,71 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRulesForAgent(t *testing.T) {
+	txt := `# partner crawl policy
+User-agent: *
+Disallow: /
+
+User-agent: Googlebot
+User-agent: Wget
+Disallow: /private/
+Allow: /private/press/
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+	rules, err := Parse(strings.NewReader(txt), "wget")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]bool{
+		"/":                       true,
+		"/private/plans.html":     false,
+		"/private/press/kit.html": true,
+		"/docs/manual.pdf":        false,
+		"/docs/manual.pdf?v=2":    true,
+		"/robots.txt":             true,
+	}
+	for path, want := range tests {
+		if got := rules.Allowed(path); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+	if rules.CrawlDelay != 1500*time.Millisecond {
+		t.Errorf("CrawlDelay = %v", rules.CrawlDelay)
+	}
+	if len(rules.Sitemaps) != 1 {
+		t.Errorf("Sitemaps = %v", rules.Sitemaps)
+	}
+
+	other, _ := Parse(strings.NewReader(txt), "curl")
+	if other.Allowed("/index.html") {
+		t.Error("agents without their own group should get the * rules")
+	}
+
+	// Only a group naming the whole product token applies
+	partial := `User-agent: w
+User-agent: get
+User-agent: wgetbot
+Disallow: /
+
+User-agent: *
+Disallow: /tmp/
+`
+	rules, _ = Parse(strings.NewReader(partial), "wget")
+	if !rules.Allowed("/index.html") || rules.Allowed("/tmp/x") {
+		t.Error("groups for w, get and wgetbot should not apply to wget")
+	}
+	versioned := "User-agent: WGET/1.21\nDisallow: /private/\n"
+	rules, _ = Parse(strings.NewReader(versioned), "wget")
+	if rules.Allowed("/private/a") {
+		t.Error("User-agent: WGET/1.21 should apply to wget")
+	}
+}
@@ -0,0 +1,184 @@
+// Package s3 is a small client for S3-compatible object storage: SigV4
+// signing, object download and upload, and prefix listing.
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client talks to one S3-compatible endpoint.
+type Client struct {
+	// Endpoint is the service URL. When nil, AWS's regional endpoint is used
+	// with virtual-hosted bucket addressing; custom endpoints (e.g. a local
+	// MinIO) use path-style addressing.
+	Endpoint *url.URL
+	Region   string
+	Creds    Credentials
+	HTTP     *http.Client
+}
+
+// Error is an S3 error response.
+type Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s (status %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// Object is one key returned by ListObjects.
+type Object struct {
+	Key  string `xml:"Key"`
+	Size int64  `xml:"Size"`
+}
+
+// objectURL builds the request URL for bucket/key.
+func (c *Client) objectURL(bucket, key string) *url.URL {
+	var u url.URL
+	if c.Endpoint == nil {
+		u.Scheme = "https"
+		u.Host = bucket + ".s3." + c.Region + ".amazonaws.com"
+		u.Path = "/" + key
+	} else {
+		u = *c.Endpoint
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	return &u
+}
+
+// do signs and sends req. Responses with a status of 300 or above, other
+// than those in allow, are turned into an *Error.
+func (c *Client) do(req *http.Request, payloadHash string, allow ...int) (*http.Response, error) {
+	if !c.Creds.Anonymous() {
+		Sign(req, c.Creds, c.Region, payloadHash, time.Now())
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	for _, code := range allow {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+
+	defer resp.Body.Close()
+	s3Err := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	xml.Unmarshal(body, s3Err)
+	return nil, s3Err
+}
+
+// GetObject starts downloading bucket/key from offset. A 416 response is
+// returned as-is so callers can tell that offset is already at the end.
+func (c *Client) GetObject(bucket, key string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.objectURL(bucket, key).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	return c.do(req, EmptyPayloadHash, http.StatusRequestedRangeNotSatisfiable)
+}
+
+// PutObject uploads size bytes from body to bucket/key. The body is read
+// twice: once to compute the payload hash for signing, then to send it.
+func (c *Client) PutObject(bucket, key string, body io.ReadSeeker, size int64) error {
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(bucket, key).String(), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+
+	resp, err := c.do(req, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+type listResult struct {
+	Contents              []Object `xml:"Contents"`
+	CommonPrefixes        []string `xml:"CommonPrefixes>Prefix"`
+	IsTruncated           bool     `xml:"IsTruncated"`
+	NextContinuationToken string   `xml:"NextContinuationToken"`
+}
+
+// ListObjects returns the objects under prefix. With a delimiter such as "/",
+// keys below the next delimiter are rolled up into the returned prefixes, as
+// if they were subdirectories.
+func (c *Client) ListObjects(bucket, prefix, delimiter string) ([]Object, []string, error) {
+	var (
+		objects  []Object
+		prefixes []string
+		token    string
+	)
+
+	for {
+		u := c.objectURL(bucket, "")
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			q.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = strings.ReplaceAll(q.Encode(), "+", "%20")
+
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := c.do(req, EmptyPayloadHash)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var page listResult
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("s3: decoding list response: %w", err)
+		}
+
+		objects = append(objects, page.Contents...)
+		prefixes = append(prefixes, page.CommonPrefixes...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, prefixes, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
@@ -0,0 +1,115 @@
+package s3
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials are the keys used to sign requests. A zero value means
+// anonymous access to public buckets.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Anonymous reports whether no keys are available.
+func (c Credentials) Anonymous() bool {
+	return c.AccessKeyID == "" || c.SecretAccessKey == ""
+}
+
+// LoadCredentials reads credentials from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN, falling back to the
+// AWS_PROFILE (default "default") section of the shared credentials file.
+func LoadCredentials() Credentials {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if !creds.Anonymous() {
+		return creds
+	}
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		file = awsFile("credentials")
+	}
+	section := readProfile(file, profileName())
+	return Credentials{
+		AccessKeyID:     section["aws_access_key_id"],
+		SecretAccessKey: section["aws_secret_access_key"],
+		SessionToken:    section["aws_session_token"],
+	}
+}
+
+// LoadRegion returns AWS_REGION, AWS_DEFAULT_REGION or the profile's region
+// from the shared config file, defaulting to us-east-1.
+func LoadRegion() string {
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if r := os.Getenv(env); r != "" {
+			return r
+		}
+	}
+
+	file := os.Getenv("AWS_CONFIG_FILE")
+	if file == "" {
+		file = awsFile("config")
+	}
+	// The config file names non-default profiles "profile NAME".
+	name := profileName()
+	if name != "default" {
+		name = "profile " + name
+	}
+	if r := readProfile(file, name)["region"]; r != "" {
+		return r
+	}
+	return "us-east-1"
+}
+
+func profileName() string {
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
+
+func awsFile(name string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// readProfile returns the key/value pairs of one [section] of an INI file.
+func readProfile(file, section string) map[string]string {
+	values := make(map[string]string)
+	f, err := os.Open(file)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			values[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
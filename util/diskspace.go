@@ -0,0 +1,31 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInsufficientSpace is returned when the target filesystem cannot hold a download.
+var ErrInsufficientSpace = errors.New("insufficient space")
+
+// availableSpace is AvailableSpace, replaced in tests to simulate a full disk.
+var availableSpace = AvailableSpace
+
+// CheckDiskSpace verifies that dir's filesystem has room for size more bytes.
+// Unknown sizes (size <= 0) and platforms without free-space information pass.
+func CheckDiskSpace(dir string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	avail, err := availableSpace(dir)
+	if err != nil || avail < 0 {
+		return nil
+	}
+
+	if avail < size {
+		return fmt.Errorf("%w on %s: need %d bytes [~%s], only %d bytes [~%s] available",
+			ErrInsufficientSpace, dir, size, ContentSize(size), avail, ContentSize(avail))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE: reserve blocks without changing the file length.
+const fallocKeepSize = 0x01
+
+// AvailableSpace returns the bytes available to unprivileged users on dir's filesystem.
+func AvailableSpace(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return -1, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// Preallocate reserves size bytes for f so the download is written contiguously.
+// The file length is left unchanged, so a short download does not leave padding.
+// Preallocation is best-effort: only running out of space is reported.
+func Preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size)
+	if err == syscall.ENOSPC {
+		return fmt.Errorf("%w on %s: cannot reserve %d bytes [~%s]",
+			ErrInsufficientSpace, f.Name(), size, ContentSize(size))
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package util
+
+import "os"
+
+// AvailableSpace is not implemented on this platform and reports an unknown amount.
+func AvailableSpace(dir string) (int64, error) {
+	return -1, nil
+}
+
+// Preallocate is a no-op on this platform.
+func Preallocate(f *os.File, size int64) error {
+	return nil
+}
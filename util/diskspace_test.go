@@ -0,0 +1,37 @@
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDiskSpace(t *testing.T) {
+	defer func(f func(string) (int64, error)) { availableSpace = f }(availableSpace)
+
+	availableSpace = func(string) (int64, error) { return 1000, nil }
+	if err := CheckDiskSpace("/data", 1000); err != nil {
+		t.Errorf("exactly enough space: %v", err)
+	}
+	if err := CheckDiskSpace("/data", -1); err != nil {
+		t.Errorf("unknown size: %v", err)
+	}
+
+	err := CheckDiskSpace("/data", 2048)
+	if !errors.Is(err, ErrInsufficientSpace) {
+		t.Fatalf("CheckDiskSpace = %v, want ErrInsufficientSpace", err)
+	}
+	want := "insufficient space on /data: need 2048 bytes [~2.00KiB], only 1000 bytes [~1000.00B] available"
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+
+	// Without free-space information the download goes ahead
+	availableSpace = func(string) (int64, error) { return -1, nil }
+	if err := CheckDiskSpace("/data", 1<<40); err != nil {
+		t.Errorf("unknown free space: %v", err)
+	}
+	availableSpace = func(string) (int64, error) { return 0, errors.New("statfs failed") }
+	if err := CheckDiskSpace("/data", 1<<40); err != nil {
+		t.Errorf("failed free-space lookup: %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package util
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchDomain reports whether host belongs to the domain pattern. A plain
+// domain such as "example.com" matches itself and all of its subdomains; a
+// pattern with wildcards such as "*.example.com" or "cdn?.example.com" is
+// matched as a glob, where "*" may span several labels. Ports and case are
+// ignored.
+func MatchDomain(host, pattern string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	pattern = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	if pattern == "" {
+		return false
+	}
+
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, err := path.Match(pattern, host)
+		return err == nil && ok
+	}
+	pattern = strings.TrimPrefix(pattern, ".")
+	return host == pattern || strings.HasSuffix(host, "."+pattern)
+}
+
+// MatchAnyDomain reports whether host matches any of the domain patterns.
+func MatchAnyDomain(host string, patterns []string) bool {
+	for _, p := range patterns {
+		if MatchDomain(host, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package util
+
+import "testing"
+
+func TestMatchDomain(t *testing.T) {
+	cases := []struct {
+		host, pattern string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"cdn.example.com", "example.com", true},
+		{"a.b.Example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com", "*.example.com", false},
+		{"static.example.com", "*.example.com", true},
+		{"a.static.example.com", "*.example.com", true},
+		{"cdn2.example.com", "cdn?.example.com", true},
+		{"cdn22.example.com", "cdn?.example.com", false},
+		{"example.org", "example.com", false},
+		{"example.com", "", false},
+	}
+	for _, c := range cases {
+		if got := MatchDomain(c.host, c.pattern); got != c.want {
+			t.Errorf("MatchDomain(%q, %q) = %v, want %v", c.host, c.pattern, got, c.want)
+		}
+	}
+}
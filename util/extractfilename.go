@@ -1,20 +1,27 @@
 package util
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"net/url"
 	"path"
 	"strings"
 )
 
 // ExtractFilenameFromURL returns the base filename from a URL.
-// If no filename is found, it falls back to "index.html".
+// If no filename is found, it falls back to "index.html". data: URLs carry
+// no name at all and are named after a hash of their contents, e.g. "data-1a2b3c4d".
 func ExtractFilenameFromURL(rawURL string) string {
 	parsed, err := url.Parse(rawURL)
+	if err == nil && parsed.Scheme == "data" {
+		sum := sha1.Sum([]byte(parsed.Opaque))
+		return "data-" + hex.EncodeToString(sum[:4])
+	}
 	if err != nil || parsed.Path == "" {
 		return "index.html"
 	}
 	filename := path.Base(parsed.Path)
-	if filename == "" || strings.HasSuffix(filename, "/") {
+	if filename == "" || filename == "." || filename == ".." || strings.HasSuffix(filename, "/") {
 		return "index.html"
 	}
 	return filename
@@ -0,0 +1,144 @@
+package util
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxNameLength is the longest file name, in bytes, most file systems allow.
+const maxNameLength = 255
+
+// FileNameRules say how URL-derived file names are made safe for the local
+// file system, as set by --restrict-file-names. The zero value is the unix
+// mode: only control characters are escaped.
+type FileNameRules struct {
+	Windows   bool // also escape \ | : ? " * < > and use @ before queries and + before ports
+	ASCII     bool // also escape bytes outside ASCII
+	Lowercase bool // convert names to lower case
+	NoControl bool // leave control characters as they are
+}
+
+// ParseRestrictFileNames parses a comma-separated --restrict-file-names
+// value made of unix, windows, ascii, lowercase and nocontrol. The default
+// mode is windows when running on Windows and unix elsewhere.
+func ParseRestrictFileNames(value string) (FileNameRules, error) {
+	rules := FileNameRules{Windows: runtime.GOOS == "windows"}
+	for _, mode := range SplitAndTrim(value, ",") {
+		switch strings.ToLower(mode) {
+		case "unix":
+			rules.Windows = false
+		case "windows":
+			rules.Windows = true
+		case "ascii":
+			rules.ASCII = true
+		case "lowercase":
+			rules.Lowercase = true
+		case "nocontrol":
+			rules.NoControl = true
+		default:
+			return FileNameRules{}, fmt.Errorf("unknown --restrict-file-names mode %q (want unix, windows, ascii, lowercase or nocontrol)", mode)
+		}
+	}
+	return rules, nil
+}
+
+// Name makes one file or directory name safe: disallowed bytes are escaped
+// as %XX, "." and ".." can no longer refer to the current or parent
+// directory, and a name longer than 255 bytes is cut short and ends in a
+// hash of the full name, keeping its extension, so that long names stay
+// distinct.
+func (r FileNameRules) Name(name string) string {
+	if r.Lowercase {
+		name = strings.ToLower(name)
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if r.escapes(c) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	safe := b.String()
+
+	if safe == "." || safe == ".." {
+		safe = strings.ReplaceAll(safe, ".", "%2E")
+	}
+	if len(safe) > maxNameLength {
+		safe = truncateName(safe)
+	}
+	return safe
+}
+
+// Host returns the directory name for a URL host, with any port. With the
+// windows rules the port is introduced by "+" instead of ":".
+func (r FileNameRules) Host(host string) string {
+	// The port follows the last colon, outside an IPv6 literal's brackets
+	if i := strings.LastIndexByte(host, ':'); r.Windows && i > strings.LastIndexByte(host, ']') {
+		host = host[:i] + "+" + host[i+1:]
+	}
+	return r.Name(host)
+}
+
+// Path applies Name to every element of a slash-separated path.
+func (r FileNameRules) Path(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = r.Name(part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// escapes reports whether byte c may not appear in a file name.
+func (r FileNameRules) escapes(c byte) bool {
+	switch {
+	case c == '/' || c == 0:
+		return true
+	case !r.NoControl && (c < 0x20 || c == 0x7f):
+		return true
+	case r.ASCII && c >= 0x80:
+		return true
+	case r.Windows:
+		return strings.IndexByte(`\|:?"*<>`, c) >= 0 || c < 0x20
+	}
+	return false
+}
+
+// truncateName shortens name to maxNameLength bytes, replacing the end of
+// its base with "~" and 8 hex digits of the SHA-1 of the whole name.
+func truncateName(name string) string {
+	sum := sha1.Sum([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:4])
+	if ext := path.Ext(name); len(ext) <= 16 {
+		suffix += ext
+	}
+
+	keep := maxNameLength - len(suffix)
+	// Do not cut a UTF-8 sequence in half
+	for keep > 0 && !utf8.RuneStart(name[keep]) {
+		keep--
+	}
+	return name[:keep] + suffix
+}
+
+// JoinWithin joins the slash-separated relative path rel to base and
+// returns an error if the result would lie outside base, so a file name
+// taken from a URL can never escape the output directory.
+func JoinWithin(base, rel string) (string, error) {
+	joined := filepath.Join(base, filepath.FromSlash(rel))
+	back, err := filepath.Rel(filepath.Clean(base), joined)
+	if err != nil || back == ".." || strings.HasPrefix(back, ".."+string(filepath.Separator)) || filepath.IsAbs(back) {
+		return "", fmt.Errorf("path %q escapes %q", rel, base)
+	}
+	return joined, nil
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRestrictFileNames(t *testing.T) {
+	rules, err := ParseRestrictFileNames("windows, ascii,LOWERCASE")
+	if err != nil || rules != (FileNameRules{Windows: true, ASCII: true, Lowercase: true}) {
+		t.Errorf("ParseRestrictFileNames = %+v, %v", rules, err)
+	}
+	if rules, _ := ParseRestrictFileNames("windows,unix,nocontrol"); rules != (FileNameRules{NoControl: true}) {
+		t.Errorf("unix after windows = %+v, want unix rules", rules)
+	}
+	if _, err := ParseRestrictFileNames("dos"); err == nil {
+		t.Error("ParseRestrictFileNames(dos) succeeded, want an error")
+	}
+}
+
+func TestFileNameRulesName(t *testing.T) {
+	cases := []struct {
+		rules      FileNameRules
+		name, want string
+	}{
+		{FileNameRules{}, "a b?c:d.html", "a b?c:d.html"},
+		{FileNameRules{}, "tab\there", "tab%09here"},
+		{FileNameRules{NoControl: true}, "tab\there", "tab\there"},
+		{FileNameRules{Windows: true}, `a?b:c*d|e"f<g>h\i`, "a%3Fb%3Ac%2Ad%7Ce%22f%3Cg%3Eh%5Ci"},
+		{FileNameRules{ASCII: true}, "café.html", "caf%C3%A9.html"},
+		{FileNameRules{Lowercase: true}, "README.HTML", "readme.html"},
+		{FileNameRules{}, "..", "%2E%2E"},
+		{FileNameRules{}, ".", "%2E"},
+		{FileNameRules{}, "..a", "..a"},
+	}
+	for _, c := range cases {
+		if got := c.rules.Name(c.name); got != c.want {
+			t.Errorf("%+v.Name(%q) = %q, want %q", c.rules, c.name, got, c.want)
+		}
+	}
+}
+
+func TestFileNameRulesTruncate(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".html"
+	other := strings.Repeat("é", 200) + "x.html"
+	got := FileNameRules{}.Name(long)
+	if len(got) > 255 || !strings.HasSuffix(got, ".html") || !strings.Contains(got, "~") {
+		t.Errorf("Name(long) = %q (%d bytes), want at most 255 bytes ending in ~hash.html", got, len(got))
+	}
+	if !strings.HasPrefix(got, strings.Repeat("é", 10)) || strings.ContainsRune(got, '�') {
+		t.Errorf("Name(long) = %q, cut a character in half", got)
+	}
+	if got == (FileNameRules{}).Name(other) {
+		t.Error("two long names truncated to the same file name")
+	}
+}
+
+func TestURLPathRestricted(t *testing.T) {
+	windows := FileNameRules{Windows: true}
+	cases := map[string]string{
+		"http://example.com:8080/a.png":  "example.com+8080/a.png",
+		"https://example.com/page?id=1":  "example.com/page@id=1",
+		"https://example.com/a:b/c.html": "example.com/a%3Ab/c.html",
+		"http://../a.html":               "%2E%2E/a.html",
+		"http://[::1]:8080/a.html":       "[%3A%3A1]+8080/a.html",
+	}
+	for raw, want := range cases {
+		got, err := URLPath(raw, windows)
+		if err != nil || got != want {
+			t.Errorf("URLPath(%q, windows) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+}
+
+func TestJoinWithin(t *testing.T) {
+	base := filepath.Join("out", "site")
+	if got, err := JoinWithin(base, "example.com/a.html"); err != nil || got != filepath.Join(base, "example.com", "a.html") {
+		t.Errorf("JoinWithin = %q, %v", got, err)
+	}
+	for _, rel := range []string{"../a.html", "example.com/../../a.html", ".."} {
+		if got, err := JoinWithin(base, rel); err == nil {
+			t.Errorf("JoinWithin(%q) = %q, want an error", rel, got)
+		}
+	}
+}
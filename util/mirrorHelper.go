@@ -1,6 +1,9 @@
 package util
 
-import "strings"
+import (
+	"path"
+	"strings"
+)
 
 // SplitAndTrim splits s by sep and trims whitespace from each element.
 // Empty elements are skipped.
@@ -16,42 +19,73 @@ func SplitAndTrim(s, sep string) []string {
 	return out
 }
 
-// ShouldReject checks if the given path ends with any of the specified suffixes.
-func ShouldReject(path string, rejectList []string) bool {
-	if len(rejectList) == 0 {
-		return false
-	}
-	lowerPath := strings.ToLower(path)
-	for _, suffix := range rejectList {
-		suff := strings.ToLower(strings.TrimSpace(suffix))
-		if suff == "" {
+// MatchFile reports whether the file name at the end of p matches any of
+// patterns. A pattern with wildcards, e.g. "report-*.pdf", is matched as a
+// glob against the name, case-insensitively with ignoreCase; any other
+// pattern is a suffix such as "jpg", which never depends on case.
+func MatchFile(p string, patterns []string, ignoreCase bool) bool {
+	name := path.Base(p)
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if isGlob(pattern) {
+			if globMatch(pattern, name, ignoreCase) {
+				return true
+			}
 			continue
 		}
+		suff := strings.ToLower(pattern)
 		// Ensure suffix begins with a dot
 		if !strings.HasPrefix(suff, ".") {
 			suff = "." + suff
 		}
-		if strings.HasSuffix(lowerPath, suff) {
+		if strings.HasSuffix(strings.ToLower(p), suff) {
 			return true
 		}
 	}
 	return false
 }
 
-// ShouldExclude checks if the given path starts with any of the specified prefixes.
-func ShouldExclude(path string, excludeList []string) bool {
-	if len(excludeList) == 0 {
-		return false
-	}
-	for _, prefix := range excludeList {
-		pref := strings.TrimSpace(prefix)
-		if pref == "" {
+// MatchDir reports whether p lies under any of the directory patterns. A
+// pattern with wildcards, e.g. "/docs/*/api", must match p or one of its
+// parent directories; any other pattern is a prefix of p such as "/assets".
+func MatchDir(p string, patterns []string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
 			continue
 		}
-		// Compare raw path segments (case‐sensitive)
-		if strings.HasPrefix(path, pref) {
-			return true
+		if !isGlob(pattern) {
+			if ignoreCase {
+				pattern, p := strings.ToLower(pattern), strings.ToLower(p)
+				if strings.HasPrefix(p, pattern) {
+					return true
+				}
+			} else if strings.HasPrefix(p, pattern) {
+				return true
+			}
+			continue
+		}
+		segments := strings.Split(p, "/")
+		for i := 1; i <= len(segments); i++ {
+			if globMatch(strings.TrimSuffix(pattern, "/"), strings.Join(segments[:i], "/"), ignoreCase) {
+				return true
+			}
 		}
 	}
 	return false
 }
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+func globMatch(pattern, name string, ignoreCase bool) bool {
+	if ignoreCase {
+		pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
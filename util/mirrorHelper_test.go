@@ -0,0 +1,48 @@
+package util
+
+import "testing"
+
+func TestMatchFile(t *testing.T) {
+	cases := []struct {
+		path       string
+		patterns   []string
+		ignoreCase bool
+		want       bool
+	}{
+		{"/files/a.PDF", []string{"pdf"}, false, true},
+		{"/files/a.pdf", []string{"zip", ".pdf"}, false, true},
+		{"/files/a.pdf.html", []string{"pdf"}, false, false},
+		{"/files/report-2024.pdf", []string{"report-*.pdf"}, false, true},
+		{"/report-dir/a.pdf", []string{"report-*"}, false, false},
+		{"/files/Report-2024.pdf", []string{"report-*.pdf"}, false, false},
+		{"/files/Report-2024.pdf", []string{"report-*.pdf"}, true, true},
+		{"/files/a.pdf", nil, false, false},
+	}
+	for _, c := range cases {
+		if got := MatchFile(c.path, c.patterns, c.ignoreCase); got != c.want {
+			t.Errorf("MatchFile(%q, %q, %v) = %v, want %v", c.path, c.patterns, c.ignoreCase, got, c.want)
+		}
+	}
+}
+
+func TestMatchDir(t *testing.T) {
+	cases := []struct {
+		path       string
+		patterns   []string
+		ignoreCase bool
+		want       bool
+	}{
+		{"/assets/logo.png", []string{"/assets"}, false, true},
+		{"/Assets/logo.png", []string{"/assets"}, false, false},
+		{"/Assets/logo.png", []string{"/assets"}, true, true},
+		{"/docs/v1/api/index.html", []string{"/docs/*/api"}, false, true},
+		{"/docs/v1/api", []string{"/docs/*/api/"}, false, true},
+		{"/docs/v1/guide/api.html", []string{"/docs/*/api"}, false, false},
+		{"/docs/V1/API/x.html", []string{"/docs/*/api"}, true, true},
+	}
+	for _, c := range cases {
+		if got := MatchDir(c.path, c.patterns, c.ignoreCase); got != c.want {
+			t.Errorf("MatchDir(%q, %q, %v) = %v, want %v", c.path, c.patterns, c.ignoreCase, got, c.want)
+		}
+	}
+}
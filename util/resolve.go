@@ -0,0 +1,34 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseResolve parses curl-style --resolve entries of the form host:port:addr
+// into a map keyed by "host:port". IPv6 addresses may be written with or
+// without brackets, e.g. "example.com:443:[::1]".
+func ParseResolve(entries []string) (map[string]string, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	overrides := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid resolve entry %q, expected host:port:addr", entry)
+		}
+
+		host, port := strings.ToLower(parts[0]), parts[1]
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid address %q in resolve entry %q", parts[2], entry)
+		}
+
+		overrides[net.JoinHostPort(host, port)] = addr
+	}
+
+	return overrides, nil
+}
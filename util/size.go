@@ -0,0 +1,53 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSize parses a byte count such as "512", "100k", "20M" or "5G".
+// An empty string, "0" or "inf" means no limit and yields 0.
+func ParseSize(size string) (int64, error) {
+	orig := size
+	size = strings.TrimSpace(size)
+	if size == "" || strings.EqualFold(size, "inf") {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToLower(size[len(size)-1:]) {
+	case "k":
+		multiplier = 1024
+	case "m":
+		multiplier = 1024 * 1024
+	case "g":
+		multiplier = 1024 * 1024 * 1024
+	case "t":
+		multiplier = 1024 * 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		size = size[:len(size)-1]
+	}
+
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size: %q", orig)
+	}
+
+	return int64(value * float64(multiplier)), nil
+}
+
+// ParseDepth parses a -l recursion depth. "inf" and "0" mean unlimited and
+// yield 0.
+func ParseDepth(depth string) (int, error) {
+	depth = strings.TrimSpace(depth)
+	if strings.EqualFold(depth, "inf") {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(depth)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid depth %q", depth)
+	}
+	return n, nil
+}
@@ -0,0 +1,32 @@
+package util
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"inf", 0},
+		{"512", 512},
+		{"100k", 100 * 1024},
+		{"20M", 20 * 1024 * 1024},
+		{"5G", 5 * 1024 * 1024 * 1024},
+		{"1.5k", 1536},
+	}
+	for _, tc := range tests {
+		got, err := ParseSize(tc.in)
+		if err != nil {
+			t.Errorf("ParseSize(%q) returned error: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tc.in, got, tc.want)
+		}
+	}
+
+	if _, err := ParseSize("5X"); err == nil {
+		t.Errorf("ParseSize(%q) expected an error", "5X")
+	}
+}
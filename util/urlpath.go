@@ -0,0 +1,87 @@
+package util
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// URLPath maps rawURL to the slash-separated path, relative to the output
+// directory, that a mirror saves it as. The mapping depends on the URL alone,
+// so the file written for a URL and the links rewritten to point at it
+// always agree, and distinct URLs get distinct files:
+//
+//   - the host, with any port, is the first directory;
+//   - a URL ending in "/" is saved as index.html in that directory;
+//   - the query string is kept in the file name, e.g. "page?id=1", with any
+//     "/" in it encoded as %2F;
+//   - a last segment without a file extension, such as "/blog" or
+//     "/docs/v1.2", is treated as a directory and saved as blog/index.html,
+//     so "/blog" and "/blog/post" can both be saved.
+//
+// Every element is then made safe by rules, so no element can be "." or ".."
+// and the path always stays below the output directory. With the windows
+// rules the query is introduced by "@" and the port by "+" instead, as "?"
+// and ":" cannot appear in Windows file names.
+func URLPath(rawURL string, rules FileNameRules) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %v", rawURL, err)
+	}
+
+	segments := strings.Split(strings.Trim(path.Clean("/"+u.Path), "/"), "/")
+	if segments[0] == "" {
+		segments = nil
+	}
+
+	host := u.Host
+	if host == "" {
+		if len(segments) == 0 {
+			host = "unknown"
+		} else {
+			host, segments = segments[0], segments[1:]
+		}
+	}
+
+	name := "index.html"
+	if n := len(segments); n > 0 && !strings.HasSuffix(u.Path, "/") {
+		if last := segments[n-1]; u.RawQuery != "" || HasFileExtension(last) {
+			name, segments = last, segments[:n-1]
+		}
+	}
+	if u.RawQuery != "" {
+		sep := "?"
+		if rules.Windows {
+			sep = "@"
+		}
+		name += sep + strings.ReplaceAll(u.RawQuery, "/", "%2F")
+	}
+
+	elems := []string{rules.Host(host)}
+	for _, elem := range append(segments, name) {
+		elems = append(elems, rules.Name(elem))
+	}
+	return path.Join(elems...), nil
+}
+
+// HasFileExtension reports whether name ends in something that looks like a
+// file extension: a dot followed by up to 8 letters and digits, at least one
+// of them a letter, as in "style.css" or "backup.tar.gz" but not "v1.2".
+func HasFileExtension(name string) bool {
+	ext := path.Ext(name)
+	if len(ext) < 2 || len(ext) > 9 || len(ext) == len(name) {
+		return false
+	}
+	letter := false
+	for _, c := range ext[1:] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+			letter = true
+		case '0' <= c && c <= '9':
+		default:
+			return false
+		}
+	}
+	return letter
+}
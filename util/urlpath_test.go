@@ -0,0 +1,28 @@
+package util
+
+import "testing"
+
+func TestURLPath(t *testing.T) {
+	cases := map[string]string{
+		"https://example.com":                 "example.com/index.html",
+		"https://example.com/":                "example.com/index.html",
+		"https://example.com/docs/":           "example.com/docs/index.html",
+		"https://example.com/a":               "example.com/a/index.html",
+		"https://example.com/a/b":             "example.com/a/b/index.html",
+		"https://example.com/docs/v1.2":       "example.com/docs/v1.2/index.html",
+		"https://example.com/style.css":       "example.com/style.css",
+		"https://example.com/dl/app.tar.gz":   "example.com/dl/app.tar.gz",
+		"https://example.com/page?id=1":       "example.com/page?id=1",
+		"https://example.com/page?id=2":       "example.com/page?id=2",
+		"https://example.com/?q=a/b":          "example.com/index.html?q=a%2Fb",
+		"https://example.com/x/../y//z.html":  "example.com/y/z.html",
+		"https://example.com/%2e%2e/etc.html": "example.com/etc.html",
+		"http://example.com:8080/a.png":       "example.com:8080/a.png",
+	}
+	for raw, want := range cases {
+		got, err := URLPath(raw, FileNameRules{})
+		if err != nil || got != want {
+			t.Errorf("URLPath(%q) = %q, %v, want %q", raw, got, err, want)
+		}
+	}
+}
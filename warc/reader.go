@@ -0,0 +1,183 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Archive serves HTTP responses recorded in a WARC file. It implements
+// http.RoundTripper, so a client using it replays a crawl without touching
+// the network. Record blocks are copied to a temporary file while the
+// archive is indexed, so large archives are not held in memory.
+type Archive struct {
+	name     string
+	spool    *os.File
+	captures map[string]block // target URI -> latest response or revisit
+	payloads map[string]block // payload digest -> response holding it
+}
+
+// block is an HTTP message stored in the spool file.
+type block struct {
+	offset, length int64
+	revisit        bool
+	refersTo       string // revisits: payload digest of the original
+	refersToURI    string // revisits: target URI of the original
+}
+
+// Open indexes the response and revisit records of a WARC file, which may
+// be gzip-compressed per record, as a whole, or not at all.
+func Open(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	spool, err := os.CreateTemp("", "wget-warc-replay-*")
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{
+		name:     name,
+		spool:    spool,
+		captures: make(map[string]block),
+		payloads: make(map[string]block),
+	}
+	if err := a.index(bufio.NewReader(r)); err != nil {
+		a.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return a, nil
+}
+
+// index reads every record from r, spooling HTTP responses.
+func (a *Archive) index(r *bufio.Reader) error {
+	tp := textproto.NewReader(r)
+	var offset int64
+
+	for {
+		version, err := tp.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if version == "" {
+			// Blank lines ending the previous record
+			continue
+		}
+		if !strings.HasPrefix(version, "WARC/") {
+			return fmt.Errorf("expected a WARC record, found %q", version)
+		}
+
+		header, err := tp.ReadMIMEHeader()
+		if err != nil {
+			return err
+		}
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("record %s: bad Content-Length", header.Get("WARC-Record-ID"))
+		}
+
+		recordType := header.Get("WARC-Type")
+		isHTTP := strings.HasPrefix(header.Get("Content-Type"), "application/http")
+		if !isHTTP || (recordType != "response" && recordType != "revisit") {
+			if _, err := io.CopyN(io.Discard, r, length); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if _, err := io.CopyN(a.spool, r, length); err != nil {
+			return err
+		}
+		b := block{offset: offset, length: length}
+		offset += length
+
+		uri := strings.Trim(header.Get("WARC-Target-URI"), "<>")
+		digest := header.Get("WARC-Payload-Digest")
+		if recordType == "revisit" {
+			b.revisit = true
+			b.refersTo = digest
+			b.refersToURI = strings.Trim(header.Get("WARC-Refers-To-Target-URI"), "<>")
+		} else if digest != "" {
+			if _, ok := a.payloads[digest]; !ok {
+				a.payloads[digest] = b
+			}
+		}
+		a.captures[uri] = b
+	}
+}
+
+// Close releases the temporary file holding the recorded responses.
+func (a *Archive) Close() error {
+	a.spool.Close()
+	return os.Remove(a.spool.Name())
+}
+
+// RoundTrip answers req with the response recorded for its URL. Revisit
+// records get the body of the response they refer to.
+func (a *Archive) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	uri := req.URL.String()
+	b, ok := a.captures[uri]
+	if !ok {
+		return nil, fmt.Errorf("%s is not recorded in %s", uri, a.name)
+	}
+
+	resp, err := a.readResponse(b, req)
+	if err != nil {
+		return nil, err
+	}
+	if !b.revisit {
+		return resp, nil
+	}
+
+	orig, ok := a.payloads[b.refersTo]
+	if !ok {
+		orig, ok = a.captures[b.refersToURI]
+	}
+	if !ok || orig.revisit {
+		return nil, fmt.Errorf("%s: revisit of %s refers to a response that is not in %s", uri, b.refersToURI, a.name)
+	}
+	origResp, err := a.readResponse(orig, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = origResp.Body
+	resp.ContentLength = origResp.ContentLength
+	resp.TransferEncoding = nil
+	return resp, nil
+}
+
+// readResponse parses the HTTP response stored in b.
+func (a *Archive) readResponse(b block, req *http.Request) (*http.Response, error) {
+	section := io.NewSectionReader(a.spool, b.offset, b.length)
+	resp, err := http.ReadResponse(bufio.NewReader(section), req)
+	if err != nil {
+		return nil, fmt.Errorf("recorded response for %s: %w", req.URL, err)
+	}
+	return resp, nil
+}
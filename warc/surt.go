@@ -0,0 +1,41 @@
+package warc
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// SURT returns the Sort-friendly URI Reordering Transform of u used as the
+// CDX key: the host labels reversed and comma-separated with a leading
+// "www." dropped, then ")" and the lowercased path and query, e.g.
+// "com,example)/about?lang=en". IP addresses are not reversed.
+func SURT(u *url.URL) string {
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+
+	var b strings.Builder
+	if net.ParseIP(host) != nil {
+		b.WriteString(host)
+	} else {
+		labels := strings.Split(host, ".")
+		for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+			labels[i], labels[j] = labels[j], labels[i]
+		}
+		b.WriteString(strings.Join(labels, ","))
+	}
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		b.WriteString(":" + port)
+	}
+	b.WriteString(")")
+
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	b.WriteString(strings.ToLower(p))
+	if u.RawQuery != "" {
+		b.WriteString("?" + strings.ToLower(u.RawQuery))
+	}
+	return b.String()
+}
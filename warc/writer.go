@@ -0,0 +1,298 @@
+// Package warc writes ISO 28500 WARC/1.1 archives of HTTP exchanges, with
+// one gzip member per record and a CDX index alongside, and replays them.
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cdxHeader names the CDX fields written for every response and revisit:
+// massaged URL, date, original URL, MIME type, status, payload digest,
+// redirect, meta tags, compressed record size, offset and file name.
+const cdxHeader = " CDX N b a m s k r M S V g"
+
+const revisitProfile = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+
+// Writer appends HTTP exchanges to a .warc.gz file and indexes them in a
+// .cdx file. It is safe for concurrent use.
+type Writer struct {
+	mu       sync.Mutex
+	file     *os.File
+	cdx      *bufio.Writer
+	cdxFile  *os.File
+	name     string
+	infoID   string
+	payloads map[string]capture // payload digest -> first capture
+}
+
+// capture identifies an earlier response with the same payload.
+type capture struct {
+	uri  string
+	date string
+}
+
+// Create opens NAME.warc.gz and NAME.cdx, truncating them, and writes the
+// warcinfo record. software is recorded in the warcinfo record.
+func Create(name, software string) (*Writer, error) {
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".warc")
+
+	f, err := os.Create(name + ".warc.gz")
+	if err != nil {
+		return nil, err
+	}
+	cdxFile, err := os.Create(name + ".cdx")
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	w := &Writer{
+		file:     f,
+		cdx:      bufio.NewWriter(cdxFile),
+		cdxFile:  cdxFile,
+		name:     name + ".warc.gz",
+		payloads: make(map[string]capture),
+	}
+	fmt.Fprintln(w.cdx, cdxHeader)
+
+	w.infoID = newRecordID()
+	info := fmt.Sprintf("software: %s\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n", software)
+	header := recordHeader{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", w.infoID},
+		{"WARC-Date", warcDate(time.Now())},
+		{"WARC-Filename", filepath.Base(w.name)},
+		{"Content-Type", "application/warc-fields"},
+	}
+	if _, _, err := w.writeRecord(header, []byte(info), nil, int64(len(info))); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// WriteExchange records a request and its response. body must yield the
+// response payload exactly as received; it is read once for each digest
+// and once more to write it, so it is never held in memory. A payload
+// already archived in this file is stored as a revisit record that only
+// carries the response headers.
+func (w *Writer) WriteExchange(req *http.Request, resp *http.Response, remoteIP string, body io.ReadSeeker) error {
+	date := time.Now()
+
+	payloadDigest, payloadLen, err := digest(body)
+	if err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var reqBlock bytes.Buffer
+	if err := req.Write(&reqBlock); err != nil {
+		return err
+	}
+
+	respHead := responseHead(resp, payloadLen)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	uri := req.URL.String()
+	respID := newRecordID()
+	reqID := newRecordID()
+	warcDate := warcDate(date)
+
+	header := recordHeader{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", respID},
+		{"WARC-Date", warcDate},
+		{"WARC-Target-URI", uri},
+		{"WARC-Warcinfo-ID", w.infoID},
+		{"WARC-Payload-Digest", payloadDigest},
+		{"Content-Type", "application/http;msgtype=response"},
+	}
+	payload, blockLen := body, int64(len(respHead))+payloadLen
+
+	prev, duplicate := w.payloads[payloadDigest]
+	if duplicate {
+		header[0].value = "revisit"
+		header = append(header,
+			headerField{"WARC-Profile", revisitProfile},
+			headerField{"WARC-Refers-To-Target-URI", prev.uri},
+			headerField{"WARC-Refers-To-Date", prev.date},
+		)
+		payload, blockLen = nil, int64(len(respHead))
+	}
+	if remoteIP != "" {
+		header = append(header, headerField{"WARC-IP-Address", remoteIP})
+	}
+
+	offset, size, err := w.writeRecord(header, respHead, payload, blockLen)
+	if err != nil {
+		return err
+	}
+	if !duplicate {
+		w.payloads[payloadDigest] = capture{uri: uri, date: warcDate}
+	}
+
+	reqHeader := recordHeader{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", reqID},
+		{"WARC-Date", warcDate},
+		{"WARC-Target-URI", uri},
+		{"WARC-Warcinfo-ID", w.infoID},
+		{"WARC-Concurrent-To", respID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}
+	if _, _, err := w.writeRecord(reqHeader, reqBlock.Bytes(), nil, int64(reqBlock.Len())); err != nil {
+		return err
+	}
+
+	mime := resp.Header.Get("Content-Type")
+	if i := strings.IndexByte(mime, ';'); i >= 0 {
+		mime = mime[:i]
+	}
+	if mime == "" {
+		mime = "-"
+	}
+	if duplicate {
+		mime = "warc/revisit"
+	}
+	redirect := resp.Header.Get("Location")
+	if redirect == "" {
+		redirect = "-"
+	}
+	fmt.Fprintf(w.cdx, "%s %s %s %s %d %s %s - %d %d %s\n",
+		SURT(req.URL), date.UTC().Format("20060102150405"), uri, mime, resp.StatusCode,
+		strings.TrimPrefix(payloadDigest, "sha1:"), redirect, size, offset, filepath.Base(w.name))
+
+	return nil
+}
+
+// Close flushes the index and closes both files.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err := w.cdx.Flush()
+	if cerr := w.cdxFile.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+type headerField struct {
+	name, value string
+}
+
+type recordHeader []headerField
+
+// writeRecord appends one gzip-compressed record whose block is head
+// followed by payload, which may be nil, and returns its offset and
+// compressed size in the file. The block digest goes in the record header,
+// so payload is read once to compute it and again, after seeking back to
+// its start, to write it. The caller must hold w.mu (or be Create).
+func (w *Writer) writeRecord(header recordHeader, head []byte, payload io.ReadSeeker, blockLen int64) (int64, int64, error) {
+	offset, err := w.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	h := sha1.New()
+	h.Write(head)
+	if payload != nil {
+		if _, err := io.Copy(h, payload); err != nil {
+			return 0, 0, err
+		}
+		if _, err := payload.Seek(0, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	gz := gzip.NewWriter(w.file)
+	bw := bufio.NewWriter(gz)
+	fmt.Fprint(bw, "WARC/1.1\r\n")
+	for _, f := range header {
+		fmt.Fprintf(bw, "%s: %s\r\n", f.name, f.value)
+	}
+	fmt.Fprintf(bw, "WARC-Block-Digest: sha1:%s\r\n", base32.StdEncoding.EncodeToString(h.Sum(nil)))
+	fmt.Fprintf(bw, "Content-Length: %d\r\n\r\n", blockLen)
+	bw.Write(head)
+	if payload != nil {
+		if _, err := io.Copy(bw, payload); err != nil {
+			return 0, 0, err
+		}
+	}
+	bw.WriteString("\r\n\r\n")
+	if err := bw.Flush(); err != nil {
+		return 0, 0, err
+	}
+	if err := gz.Close(); err != nil {
+		return 0, 0, err
+	}
+
+	end, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	return offset, end - offset, nil
+}
+
+// responseHead renders the status line and headers of resp. Go's client
+// has already removed any chunked transfer coding from the body, so the
+// recorded headers describe the body as stored: Transfer-Encoding is
+// dropped and Content-Length is set to the payload length.
+func responseHead(resp *http.Response, payloadLen int64) []byte {
+	var b bytes.Buffer
+	proto := resp.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&b, "%s %s\r\n", proto, resp.Status)
+
+	header := resp.Header.Clone()
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", fmt.Sprint(payloadLen))
+	header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// digest returns the WARC sha1 digest of r and its length.
+func digest(r io.Reader) (string, int64, error) {
+	h := sha1.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return "sha1:" + base32.StdEncoding.EncodeToString(h.Sum(nil)), n, nil
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+func newRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40 // version 4
+	u[8] = u[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
@@ -0,0 +1,209 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func exchange(t *testing.T, rawURL string) (*http.Request, *http.Response) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Request:    req,
+	}
+	return req, resp
+}
+
+func TestWriterRevisitAndCDX(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "crawl")
+	w, err := Create(name, "wget-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, u := range []string{"http://www.example.com/a", "http://www.example.com/b?x=1"} {
+		req, resp := exchange(t, u)
+		if err := w.WriteExchange(req, resp, "192.0.2.1", strings.NewReader("same body")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name + ".warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	all, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if v, ok := strings.CutPrefix(line, "WARC-Type: "); ok {
+			types = append(types, v)
+		}
+	}
+	want := "warcinfo response request revisit request"
+	if got := strings.Join(types, " "); got != want {
+		t.Errorf("record types = %q, want %q", got, want)
+	}
+
+	cdx, err := os.ReadFile(name + ".cdx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimRight(string(cdx), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != cdxHeader {
+		t.Fatalf("cdx = %q", cdx)
+	}
+	fields := strings.Fields(lines[2])
+	if fields[0] != "com,example)/b?x=1" || fields[3] != "warc/revisit" {
+		t.Errorf("revisit cdx line = %q", lines[2])
+	}
+
+	// The offset in the index must point at the start of the gzip member
+	offset, _ := strconv.ParseInt(fields[9], 10, 64)
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	member, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member.Multistream(false)
+	r := bufio.NewReader(member)
+	r.ReadString('\n')
+	typeLine, _ := r.ReadString('\n')
+	if typeLine != "WARC-Type: revisit\r\n" {
+		t.Errorf("record at cdx offset starts with %q", typeLine)
+	}
+}
+
+func TestWriterBlockDigest(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "crawl")
+	w, err := Create(name, "wget-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, resp := exchange(t, "http://www.example.com/big")
+	payload := strings.Repeat("0123456789", 10000)
+	if err := w.WriteExchange(req, resp, "", strings.NewReader(payload)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name + ".warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	all, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(all)
+	for {
+		var blockDigest string
+		var length int64
+		inResponse := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal("no response record found")
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			inResponse = inResponse || line == "WARC-Type: response"
+			if v, ok := strings.CutPrefix(line, "WARC-Block-Digest: "); ok {
+				blockDigest = v
+			}
+			if v, ok := strings.CutPrefix(line, "Content-Length: "); ok {
+				length, _ = strconv.ParseInt(v, 10, 64)
+			}
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(r, block); err != nil {
+			t.Fatal(err)
+		}
+		r.Discard(4) // the record's trailing CRLF CRLF
+		if !inResponse {
+			continue
+		}
+		if !strings.HasSuffix(string(block), "\r\n\r\n"+payload) {
+			t.Error("response block does not end in the payload")
+		}
+		if want, _, _ := digest(strings.NewReader(string(block))); blockDigest != want {
+			t.Errorf("WARC-Block-Digest = %s, want %s", blockDigest, want)
+		}
+		return
+	}
+}
+
+func TestSURT(t *testing.T) {
+	u, _ := url.Parse("https://WWW.Example.co.uk:8443/Path/Page?Q=1")
+	if got, want := SURT(u), "uk,co,example:8443)/path/page?q=1"; got != want {
+		t.Errorf("SURT = %q, want %q", got, want)
+	}
+}
+
+func TestArchiveReplaysRevisits(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "crawl")
+	w, err := Create(name, "wget-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"http://example.com/a", "http://example.com/b"} {
+		req, resp := exchange(t, u)
+		if err := w.WriteExchange(req, resp, "", strings.NewReader("same body")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	a, err := Open(name + ".warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	client := &http.Client{Transport: a}
+
+	resp, err := client.Get("http://example.com/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(body) != "same body" {
+		t.Errorf("replayed revisit = %d %q", resp.StatusCode, body)
+	}
+
+	if _, err := client.Get("http://example.com/missing"); err == nil {
+		t.Error("expected an error for a URL that was not recorded")
+	}
+}
@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"errors"
+
 	"github.com/jesee-kuya/wget/downloader"
 	"github.com/jesee-kuya/wget/logger"
 )
@@ -8,14 +10,19 @@ import (
 func Execute(opts downloader.Options, urlArg string, log logger.Logger) {
 	if opts.InputFile != "" {
 		downloader.DownloadInput(opts, &log)
-	} else if opts.Mirror {
+	} else if opts.Metalink {
+		err := downloader.DownloadMetalink(urlArg, opts, &log)
+		if err != nil {
+			log.Error(err)
+		}
+	} else if opts.Mirror || opts.Recursive || opts.PageRequisites {
 		err := downloader.MirrorSite(urlArg, opts, &log)
 		if err != nil {
 			log.Error(err)
 		}
 	} else {
 		err := downloader.DownloadFile(urlArg, opts, &log)
-		if err != nil {
+		if err != nil && !errors.Is(err, downloader.ErrFileTooLarge) {
 			log.Error(err)
 		}
 	}
@@ -4,11 +4,25 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/jesee-kuya/wget/downloader"
 	"github.com/jesee-kuya/wget/util"
 )
 
+// stringList collects the values of a flag that may be given more than once.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func ParseFlags() (downloader.Options, string, bool) {
 	rejectList := ""
 	excludeList := ""
@@ -18,11 +32,65 @@ func ParseFlags() (downloader.Options, string, bool) {
 	outputDir := flag.String("P", "", "Specify directory to save the file")
 	rateLimit := flag.String("rate-limit", "", "Limit download speed (e.g., 100k, 1M)")
 	mirror := flag.Bool("mirror", false, "Mirror the entire website starting from the given URL")
-	reject := flag.String("reject", "", "Comma-separated suffixes to reject (e.g. jpg,gif)")
-	rejectShort := flag.String("R", "", "Comma-separated suffixes to reject (e.g. jpg,gif)")
-	exclude := flag.String("exclude", "", "Comma-separated directories to exclude (e.g. /js,/assets)")
-	excludeShort := flag.String("X", "", "Comma-separated directories to exclude (e.g. /js,/assets)")
+	recursive := flag.Bool("r", false, "Retrieve recursively, following links up to -l levels deep")
+	recursiveLong := flag.Bool("recursive", false, "Retrieve recursively, following links up to -l levels deep")
+	level := flag.String("l", "", "Maximum recursion depth for -r and --mirror, or inf (default 5 for -r, inf for --mirror)")
+	levelLong := flag.String("level", "", "Maximum recursion depth for -r and --mirror, or inf (default 5 for -r, inf for --mirror)")
+	accept := flag.String("accept", "", "Comma-separated suffixes or globs to accept (e.g. pdf,report-*.zip)")
+	acceptShort := flag.String("A", "", "Comma-separated suffixes or globs to accept (e.g. pdf,report-*.zip)")
+	acceptRegex := flag.String("accept-regex", "", "Only save URLs, query string included, matching this regular expression")
+	rejectRegex := flag.String("reject-regex", "", "Do not save URLs, query string included, matching this regular expression")
+	include := flag.String("include", "", "Comma-separated directories or globs to crawl (e.g. /docs,/docs/*/api)")
+	includeShort := flag.String("I", "", "Comma-separated directories or globs to crawl (e.g. /docs,/docs/*/api)")
+	ignoreCase := flag.Bool("ignore-case", false, "Ignore case when matching -A, -R, -I, -X and regex filters")
+	reject := flag.String("reject", "", "Comma-separated suffixes or globs to reject (e.g. jpg,gif)")
+	rejectShort := flag.String("R", "", "Comma-separated suffixes or globs to reject (e.g. jpg,gif)")
+	exclude := flag.String("exclude", "", "Comma-separated directories or globs to exclude (e.g. /js,/assets)")
+	excludeShort := flag.String("X", "", "Comma-separated directories or globs to exclude (e.g. /js,/assets)")
+	canonical := flag.Bool("canonical", false, "Skip pages whose rel=canonical URL is another page, fetching that one instead")
+	pageRequisites := flag.Bool("p", false, "Also download everything needed to display each page (images, scripts, stylesheets, media)")
+	pageRequisitesLong := flag.Bool("page-requisites", false, "Also download everything needed to display each page (images, scripts, stylesheets, media)")
+	noParent := flag.Bool("no-parent", false, "Do not ascend above the start URL's directory when recursing")
+	noParentShort := flag.Bool("np", false, "Do not ascend above the start URL's directory when recursing")
+	spanHosts := flag.Bool("H", false, "Follow links to other hosts when recursing")
+	spanHostsLong := flag.Bool("span-hosts", false, "Follow links to other hosts when recursing")
+	domains := flag.String("D", "", "Comma-separated domains to follow when recursing (e.g. example.com,*.cdn.net)")
+	domainsLong := flag.String("domains", "", "Comma-separated domains to follow when recursing (e.g. example.com,*.cdn.net)")
+	excludeDomains := flag.String("exclude-domains", "", "Comma-separated domains never to follow when recursing")
+	adjustExtension := flag.Bool("E", false, "Add .html or .css to mirrored files served as HTML or CSS without that extension")
+	adjustExtensionLong := flag.Bool("adjust-extension", false, "Add .html or .css to mirrored files served as HTML or CSS without that extension")
+	restrictFileNames := flag.String("restrict-file-names", "", "Escape characters in saved file names: unix, windows, ascii, lowercase, nocontrol (comma-separated)")
 	convertLinks := flag.Bool("convert-links", false, "convert the links in the downloaded files so that they can be viewed offline")
+	quota := flag.String("Q", "", "Total download quota for -i and --mirror (e.g. 500M, 5G)")
+	maxFileSize := flag.String("max-filesize", "", "Skip files larger than this size (e.g. 10M)")
+	inet4Only := flag.Bool("4", false, "Connect only to IPv4 addresses")
+	inet4OnlyLong := flag.Bool("inet4-only", false, "Connect only to IPv4 addresses")
+	inet6Only := flag.Bool("6", false, "Connect only to IPv6 addresses")
+	inet6OnlyLong := flag.Bool("inet6-only", false, "Connect only to IPv6 addresses")
+	bindAddress := flag.String("bind-address", "", "Local address (IP or hostname) to connect from")
+	unixSocket := flag.String("unix-socket", "", "Connect through this Unix domain socket instead of TCP")
+	continueDownload := flag.Bool("c", false, "Resume getting a partially-downloaded file")
+	continueLong := flag.Bool("continue", false, "Resume getting a partially-downloaded file")
+	ftpUser := flag.String("ftp-user", "", "FTP user name (default anonymous)")
+	ftpPassword := flag.String("ftp-password", "", "FTP password")
+	noPassiveFTP := flag.Bool("no-passive-ftp", false, "Use active mode for FTP data connections")
+	sshKey := flag.String("ssh-key", "", "Private key file for sftp:// URLs")
+	knownHosts := flag.String("known-hosts", "", "known_hosts file for sftp:// host key verification (default ~/.ssh/known_hosts)")
+	s3Endpoint := flag.String("s3-endpoint", "", "S3-compatible endpoint URL for s3:// URLs (e.g. http://localhost:9000)")
+	outputSink := flag.String("output-sink", "", "Write downloads to a directory, a .tar/.tar.gz/.zip archive, or s3://bucket/prefix")
+	warcFile := flag.String("warc-file", "", "Record HTTP requests and responses to NAME.warc.gz with a NAME.cdx index")
+	fromWARC := flag.String("from-warc", "", "Replay HTTP responses recorded in this WARC file instead of using the network")
+	metalinkDoc := flag.Bool("metalink", false, "Treat the URL or file argument as a Metalink v4 document")
+	metalinkParallel := flag.Int("metalink-parallel", 1, "Fetch Metalink pieces from several mirrors over this many connections")
+	sitemap := flag.Bool("sitemap", false, "Also crawl the pages listed in the site's sitemaps (robots.txt Sitemap: lines or /sitemap.xml)")
+	sitemapLastMod := flag.Bool("sitemap-lastmod", false, "With --sitemap, skip pages whose lastmod is not newer than the local copy")
+	mirrorWorkers := flag.Int("mirror-workers", 1, "Number of URLs --mirror fetches concurrently")
+	mirrorHostLimit := flag.Int("mirror-host-limit", 4, "Maximum concurrent --mirror requests to one host (0 = no limit)")
+	preferredLocation := flag.String("preferred-location", "", "Comma-separated country codes of Metalink mirrors to try first")
+	var resolve stringList
+	flag.Var(&resolve, "resolve", "Resolve host:port to addr instead of using DNS (host:port:addr, repeatable)")
+	var commands stringList
+	flag.Var(&commands, "e", "Execute a wgetrc-style command, e.g. robots=off (repeatable)")
 
 	flag.Parse()
 	args := flag.Args()
@@ -39,6 +107,15 @@ func ParseFlags() (downloader.Options, string, bool) {
 		excludeList = *exclude
 	}
 
+	acceptList := *acceptShort
+	if acceptList == "" {
+		acceptList = *accept
+	}
+	includeList := *includeShort
+	if includeList == "" {
+		includeList = *include
+	}
+
 	var urlArg string
 	if *inputFile == "" {
 		if len(args) == 0 {
@@ -56,18 +133,163 @@ func ParseFlags() (downloader.Options, string, bool) {
 		os.Exit(1)
 	}
 
+	parsedQuota, err := util.ParseSize(*quota)
+	if err != nil {
+		fmt.Println("Error parsing quota:", err)
+		os.Exit(1)
+	}
+
+	parsedMaxFileSize, err := util.ParseSize(*maxFileSize)
+	if err != nil {
+		fmt.Println("Error parsing max file size:", err)
+		os.Exit(1)
+	}
+
+	parsedResolve, err := util.ParseResolve(resolve)
+	if err != nil {
+		fmt.Println("Error parsing --resolve:", err)
+		os.Exit(1)
+	}
+
+	compiledAccept, err := compileFilter(*acceptRegex, *ignoreCase)
+	if err != nil {
+		fmt.Println("Error parsing --accept-regex:", err)
+		os.Exit(1)
+	}
+
+	compiledReject, err := compileFilter(*rejectRegex, *ignoreCase)
+	if err != nil {
+		fmt.Println("Error parsing --reject-regex:", err)
+		os.Exit(1)
+	}
+
+	parsedRules, err := util.ParseRestrictFileNames(*restrictFileNames)
+	if err != nil {
+		fmt.Println("Error parsing --restrict-file-names:", err)
+		os.Exit(1)
+	}
+
+	levelArg := *level
+	if levelArg == "" {
+		levelArg = *levelLong
+	}
+	var maxDepth int
+	switch {
+	case levelArg != "":
+		maxDepth, err = util.ParseDepth(levelArg)
+		if err != nil {
+			fmt.Println("Error parsing -l:", err)
+			os.Exit(1)
+		}
+	case !*mirror:
+		maxDepth = 5
+	}
+
+	if *mirrorWorkers < 1 {
+		fmt.Println("Error: --mirror-workers must be at least 1")
+		os.Exit(1)
+	}
+
+	if (*inet4Only || *inet4OnlyLong) && (*inet6Only || *inet6OnlyLong) {
+		fmt.Println("Error: -4 and -6 cannot be used together")
+		os.Exit(1)
+	}
+
 	opts := downloader.Options{
-		OutputName:  *output,
-		OutputDir:   *outputDir,
-		InputFile:   *inputFile,
-		RateLimit:   parsedRate,
-		RunInBg:     *background,
-		LogFilePath: "wget-log",
-		Reject:      util.SplitAndTrim(rejectList, ","),
-		Exclude:     util.SplitAndTrim(excludeList, ","),
-		ConvertLink: *convertLinks,
-		Mirror:      *mirror,
+		OutputName:        *output,
+		OutputDir:         *outputDir,
+		InputFile:         *inputFile,
+		RateLimit:         parsedRate,
+		RunInBg:           *background,
+		LogFilePath:       "wget-log",
+		Accept:            util.SplitAndTrim(acceptList, ","),
+		Reject:            util.SplitAndTrim(rejectList, ","),
+		AcceptRegex:       compiledAccept,
+		RejectRegex:       compiledReject,
+		Include:           util.SplitAndTrim(includeList, ","),
+		Exclude:           util.SplitAndTrim(excludeList, ","),
+		IgnoreCase:        *ignoreCase,
+		Canonical:         *canonical,
+		PageRequisites:    *pageRequisites || *pageRequisitesLong,
+		NoParent:          *noParent || *noParentShort,
+		SpanHosts:         *spanHosts || *spanHostsLong,
+		Domains:           util.SplitAndTrim(*domains+","+*domainsLong, ","),
+		ExcludeDomains:    util.SplitAndTrim(*excludeDomains, ","),
+		AdjustExtension:   *adjustExtension || *adjustExtensionLong,
+		RestrictFileNames: parsedRules,
+		ConvertLink:       *convertLinks,
+		Mirror:            *mirror,
+		Recursive:         *recursive || *recursiveLong,
+		MaxDepth:          maxDepth,
+		Quota:             parsedQuota,
+		MaxFileSize:       parsedMaxFileSize,
+		Inet4Only:         *inet4Only || *inet4OnlyLong,
+		Inet6Only:         *inet6Only || *inet6OnlyLong,
+		BindAddress:       *bindAddress,
+		UnixSocket:        *unixSocket,
+		Resolve:           parsedResolve,
+		Continue:          *continueDownload || *continueLong,
+		FTPUser:           *ftpUser,
+		FTPPassword:       *ftpPassword,
+		NoPassiveFTP:      *noPassiveFTP,
+		SSHKey:            *sshKey,
+		KnownHosts:        *knownHosts,
+		S3Endpoint:        *s3Endpoint,
+		OutputSink:        *outputSink,
+		WARCFile:          *warcFile,
+		FromWARC:          *fromWARC,
+		Metalink:          *metalinkDoc,
+		MetalinkParallel:  *metalinkParallel,
+		PreferredLocation: util.SplitAndTrim(*preferredLocation, ","),
+		Sitemap:           *sitemap || *sitemapLastMod,
+		SitemapLastMod:    *sitemapLastMod,
+		MirrorWorkers:     *mirrorWorkers,
+		MirrorHostLimit:   *mirrorHostLimit,
+	}
+
+	if err := applyCommands(commands, &opts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
 	}
 
 	return opts, urlArg, *background
 }
+
+// compileFilter compiles a --accept-regex or --reject-regex expression,
+// returning nil when none was given.
+func compileFilter(expr string, ignoreCase bool) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if ignoreCase {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// applyCommands applies -e commands of the form name=value to opts.
+func applyCommands(commands []string, opts *downloader.Options) error {
+	for _, cmd := range commands {
+		name, value, ok := strings.Cut(cmd, "=")
+		if !ok {
+			return fmt.Errorf("invalid command %q, expected name=value", cmd)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		switch name {
+		case "robots":
+			switch value {
+			case "on":
+				opts.IgnoreRobots = false
+			case "off":
+				opts.IgnoreRobots = true
+			default:
+				return fmt.Errorf("robots must be on or off, got %q", value)
+			}
+		default:
+			return fmt.Errorf("unknown command %q", name)
+		}
+	}
+	return nil
+}